@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+)
+
+// headerFlag collects repeated -header "Name: value" flags, e.g. the
+// CF-Access-Client-Id and CF-Access-Client-Secret of a Cloudflare Access
+// service token.
+type headerFlag map[string]string
+
+func (h headerFlag) String() string {
+	var names []string
+	for name := range h {
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (h headerFlag) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("expected \"Name: value\", got %q", value)
+	}
+	h[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	return nil
+}
+
+// keepCookies makes t keep cookies between requests, such as the
+// CF_Authorization cookie Cloudflare Access hands out after a login.
+func (t *target) keepCookies() {
+	jar, _ := cookiejar.New(nil)
+	t.client.Jar = jar
+}
+
+// sameHostRedirect follows redirects within the node's host only. Access
+// proxies redirect unauthenticated requests to a login page elsewhere,
+// whose HTML would otherwise be handed to the JSON parsing.
+func sameHostRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("redirected to %s, the node API may be behind an access proxy needing -header or -cookies", req.URL.Host)
+	}
+	return nil
+}
+
+func statusError(method, endpoint string, r *http.Response, body []byte) error {
+	err := fmt.Errorf("%s %s: unexpected status %s", method, endpoint, r.Status)
+	if !looksLikeJson(body) && len(body) > 0 {
+		err = fmt.Errorf("%v, got %s", err, snippet(r, body))
+	}
+	if r.StatusCode == http.StatusUnauthorized || r.StatusCode == http.StatusForbidden {
+		err = fmt.Errorf("%v, the node API may be behind an access proxy needing -header or -cookies", err)
+	}
+	return err
+}
+
+// looksLikeJson tells JSON responses from the HTML error pages of proxies in
+// front of the node, without parsing them.
+func looksLikeJson(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+// snippet describes a response body that is not JSON by its content type
+// and beginning, e.g. the title of an HTML 502 page.
+func snippet(r *http.Response, body []byte) string {
+	text := strings.Join(strings.Fields(string(body)), " ")
+	if len(text) > 120 {
+		text = text[:120] + "..."
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "no content type"
+	}
+	return fmt.Sprintf("%s: %q", contentType, text)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type catalogEntry struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Help   string   `json:"help"`
+	Labels []string `json:"labels"`
+	Source string   `json:"source"`
+}
+
+// catalog holds what is known about every metric of the exporter by name.
+// Metrics are noted when created by newGauge and the like, as collectors
+// only describe them through an opaque Desc, and added to the catalog once
+// registered by registerFrom.
+var catalog = struct {
+	sync.Mutex
+	created map[prometheus.Collector]catalogEntry
+	entries map[string]*catalogEntry
+}{
+	created: map[prometheus.Collector]catalogEntry{},
+	entries: map[string]*catalogEntry{},
+}
+
+func noteCreated(c prometheus.Collector, valueType, namespace, subsystem, name, help string, constLabels prometheus.Labels, labelNames []string) {
+	entry := catalogEntry{
+		Name:   prometheus.BuildFQName(namespace, subsystem, name),
+		Type:   valueType,
+		Help:   help,
+		Labels: append([]string(nil), labelNames...),
+	}
+	for label := range constLabels {
+		entry.Labels = append(entry.Labels, label)
+	}
+
+	catalog.Lock()
+	catalog.created[c] = entry
+	catalog.Unlock()
+}
+
+func newGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	g := prometheus.NewGauge(opts)
+	noteCreated(g, "gauge", opts.Namespace, opts.Subsystem, opts.Name, opts.Help, opts.ConstLabels, nil)
+	return g
+}
+
+func newGaugeVec(opts prometheus.GaugeOpts, labelNames []string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(opts, labelNames)
+	noteCreated(g, "gauge", opts.Namespace, opts.Subsystem, opts.Name, opts.Help, opts.ConstLabels, labelNames)
+	return g
+}
+
+func newGaugeFunc(opts prometheus.GaugeOpts, function func() float64) prometheus.GaugeFunc {
+	g := prometheus.NewGaugeFunc(opts, function)
+	noteCreated(g, "gauge", opts.Namespace, opts.Subsystem, opts.Name, opts.Help, opts.ConstLabels, nil)
+	return g
+}
+
+func newCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	c := prometheus.NewCounter(opts)
+	noteCreated(c, "counter", opts.Namespace, opts.Subsystem, opts.Name, opts.Help, opts.ConstLabels, nil)
+	return c
+}
+
+func newCounterVec(opts prometheus.CounterOpts, labelNames []string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(opts, labelNames)
+	noteCreated(c, "counter", opts.Namespace, opts.Subsystem, opts.Name, opts.Help, opts.ConstLabels, labelNames)
+	return c
+}
+
+func newCounterFunc(opts prometheus.CounterOpts, function func() float64) prometheus.CounterFunc {
+	c := prometheus.NewCounterFunc(opts, function)
+	noteCreated(c, "counter", opts.Namespace, opts.Subsystem, opts.Name, opts.Help, opts.ConstLabels, nil)
+	return c
+}
+
+func newHistogram(opts prometheus.HistogramOpts) prometheus.Histogram {
+	h := prometheus.NewHistogram(opts)
+	noteCreated(h, "histogram", opts.Namespace, opts.Subsystem, opts.Name, opts.Help, opts.ConstLabels, nil)
+	return h
+}
+
+// labelledRegisterer adds labels to the metrics registered with it, like
+// prometheus.WrapRegistererWith, and tells registerFrom which.
+type labelledRegisterer struct {
+	prometheus.Registerer
+	labels prometheus.Labels
+}
+
+func wrapRegisterer(labels prometheus.Labels, registerer prometheus.Registerer) prometheus.Registerer {
+	return labelledRegisterer{prometheus.WrapRegistererWith(labels, registerer), labels}
+}
+
+// registererLabels returns the names of the labels registerer adds.
+func registererLabels(registerer prometheus.Registerer) []string {
+	var names []string
+	if l, ok := registerer.(labelledRegisterer); ok {
+		for name := range l.labels {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// registerFrom registers cs with registerer, adding them to the catalog as
+// coming from source.
+func registerFrom(registerer prometheus.Registerer, source string, cs ...prometheus.Collector) {
+	for _, c := range cs {
+		registerer.MustRegister(c)
+
+		created := c
+		if g, ok := c.(gatedCollector); ok {
+			created = g.Collector
+		}
+
+		catalog.Lock()
+		entry, found := catalog.created[created]
+		delete(catalog.created, created)
+		catalog.Unlock()
+		if found {
+			entry.Source = source
+			addToCatalog(entry, registererLabels(registerer))
+		}
+	}
+}
+
+// addToCatalog adds entry to the catalog with more label names, merging
+// the label names of a metric registered once per target.
+func addToCatalog(entry catalogEntry, labels []string) {
+	catalog.Lock()
+	defer catalog.Unlock()
+
+	names := append(entry.Labels, labels...)
+	known, found := catalog.entries[entry.Name]
+	if !found {
+		known = &entry
+		known.Labels = nil
+		catalog.entries[entry.Name] = known
+	}
+	for _, label := range names {
+		if !containsName(known.Labels, label) {
+			known.Labels = append(known.Labels, label)
+		}
+	}
+	sort.Strings(known.Labels)
+}
+
+func init() {
+	serveMux.HandleFunc("/api/v1/metric-catalog", metricCatalog)
+}
+
+// metricCatalog serves every metric of the exporter as JSON, for tooling
+// generating recording rules and documentation. Registered metrics are
+// listed up front; those of Collectors and exec commands, and the
+// /system/info gauges, once collected.
+func metricCatalog(w http.ResponseWriter, r *http.Request) {
+	catalog.Lock()
+	entries := []catalogEntry{}
+	for _, entry := range catalog.entries {
+		e := *entry
+		e.Labels = append([]string{}, entry.Labels...)
+		entries = append(entries, e)
+	}
+	catalog.Unlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
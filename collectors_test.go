@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/tidwall/gjson"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden .prom files of testdata/fixtures from the collectors' output")
+
+// fixtureTransport answers requests with the file named after the endpoint,
+// e.g. system_info.json for GET /system/info, of the first of dirs having
+// one. Endpoints without a file get a 404.
+type fixtureTransport struct {
+	dirs []string
+}
+
+func (f fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := strings.Replace(strings.Trim(req.URL.Path, "/"), "/", "_", -1) + ".json"
+	status, body := http.StatusNotFound, []byte(`{"error":"no fixture"}`)
+	for _, dir := range f.dirs {
+		data, readErr := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(readErr) {
+			continue
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+		status, body = http.StatusOK, data
+		break
+	}
+
+	return &http.Response{
+		Status:     http.StatusText(status),
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// Collection cycles of fixtures happen at fixtureTime, a bit after the epoch
+// proof of testdata/fixtures, and then every fixtureInterval
+var (
+	fixtureTime     = time.Unix(1792160900, 0)
+	fixtureInterval = time.Hour
+)
+
+// collectorFixture runs collectors against recorded node API responses and
+// compares metrics with testdata/fixtures/<name>.prom. To cover a new node
+// API field, add it to the recorded response and run
+// go test -run TestCollectors -update, then review the golden file's diff.
+// Forks can test the Collectors they register the same way, calling
+// testCollectorFixture from a _test.go file of their own.
+type collectorFixture struct {
+	name string
+
+	// Collectors to run in order, by the name they are registered under
+	collectors []string
+
+	// Directories of responses that differ from testdata/fixtures, one per
+	// collection cycle, "" for none. Without any, there is one cycle.
+	cycles []string
+
+	// Configures the target before the first cycle, e.g. with a gateway
+	setup func(t *testing.T, target *target)
+
+	metrics []string
+}
+
+var collectorFixtures = []collectorFixture{
+	{
+		name:       "info",
+		collectors: []string{"info"},
+		metrics: []string{
+			"radix_info_counters_bft_vertex_store_size",
+			"radix_info_counters_ledger_state_version",
+			"radix_info_epochManager_currentView_epoch",
+			"radix_info_configuration_bftSyncPatienceMillis",
+		},
+	},
+	{
+		name:       "network",
+		collectors: []string{"info"},
+		metrics: []string{
+			"radix_network_bytes_total",
+			"radix_network_messages_total",
+			"radix_network_tcp_connections_opened_total",
+			"radix_network_udp_dropped_messages_total",
+		},
+	},
+	{
+		name:       "consensus",
+		collectors: []string{"info"},
+		metrics: []string{
+			"radix_consensus_vertex_store_size",
+			"radix_consensus_vertex_store_forks",
+			"radix_consensus_vertex_store_rebuilds_total",
+			"radix_consensus_queued_events",
+			"radix_sync_state_versions_behind",
+		},
+	},
+	{
+		name:       "peers",
+		collectors: []string{"peers"},
+		metrics:    []string{"radix_validator_peers_count"},
+	},
+	{
+		name:       "epochproof",
+		collectors: []string{"epochproof"},
+		metrics: []string{
+			"radix_validator_next_validators_count",
+			"radix_validator_next_validators_stake_min",
+			"radix_validator_next_validators_stake_max",
+		},
+	},
+	{
+		name:       "validator",
+		collectors: []string{"validator"},
+		metrics: []string{
+			"radix_validator_stake_total",
+			"radix_validator_delegators_count",
+			"radix_validator_stake_owner",
+			"radix_validator_stake_external",
+			"radix_validator_stake_owner_ratio",
+		},
+	},
+	{
+		name:       "connectivity",
+		collectors: []string{"peers", "epochproof", "validator", "connectivity"},
+		metrics: []string{
+			"radix_peers_validators_connected_count",
+			"radix_peers_validator_stake_connected_ratio",
+		},
+	},
+	{
+		name:       "gateway",
+		collectors: []string{"gateway"},
+		cycles:     []string{"testdata/fixtures/gateway"},
+		setup: func(t *testing.T, target *target) {
+			target.setGateway("http://gateway")
+		},
+		metrics: []string{
+			"radix_gateway_network_id",
+			"radix_gateway_ledger_state_version",
+			"radix_gateway_round_timestamp_seconds",
+			"radix_gateway_ledger_state_version_behind",
+			"radix_gateway_up",
+		},
+	},
+	{
+		name:       "slo",
+		collectors: []string{"validator", "slo"},
+		cycles:     []string{"testdata/fixtures/slo/1", "testdata/fixtures/slo/2", "testdata/fixtures/slo/3"},
+		setup: func(t *testing.T, target *target) {
+			target.setSLO(&sloConfig{Gateway: "http://olympia-gateway", Proposals: 99, Window: 24 * time.Hour, BurnWindows: []time.Duration{time.Hour, 6 * time.Hour}})
+		},
+		metrics: []string{
+			"radix_validator_slo_error_budget_remaining_ratio",
+			"radix_validator_slo_burn_rate",
+		},
+	},
+	{
+		name:       "meta",
+		collectors: []string{"info", "meta"},
+		setup: func(t *testing.T, target *target) {
+			target.setMetaLabels([]metaLabel{
+				{Name: "version", Endpoint: "/system/info", Path: "agent.version"},
+				{Name: "validator", Endpoint: "/node/validator", Path: "validator.address"},
+			})
+		},
+		metrics: []string{"radix_node_meta"},
+	},
+	{
+		name:       "delegators",
+		collectors: []string{"validator"},
+		setup: func(t *testing.T, target *target) {
+			target.setDelegatorExport(delegatorExport{Export: "hashed", Salt: "fixture", Length: 8})
+		},
+		metrics: []string{"radix_validator_delegator_stake"},
+	},
+	{
+		name:       "exec",
+		collectors: []string{"exec"},
+		setup: func(t *testing.T, target *target) {
+			target.execCommands = []execCommand{
+				{Name: "backup", Command: []string{"echo", `{"age_seconds": 3600, "ok": true}`}},
+				{Name: "broken", Command: []string{"false"}},
+			}
+		},
+		metrics: []string{"radix_exec_backup_age_seconds", "radix_exec_success"},
+	},
+	{
+		name:       "epoch",
+		collectors: []string{"epochproof"},
+		cycles:     []string{"", "", "testdata/fixtures/epoch/2"},
+		metrics:    []string{"radix_ledger_seconds_since_epoch_change"},
+	},
+	{
+		name:       "restarts",
+		collectors: []string{"info"},
+		cycles:     []string{"", "testdata/fixtures/restarts/2", ""},
+		setup: func(t *testing.T, target *target) {
+			previous := restartCounter
+			restartCounter = "info.counters.messages.inbound.received"
+			t.Cleanup(func() { restartCounter = previous })
+		},
+		metrics: []string{"radix_node_restarts_total", "radix_node_start_time_seconds"},
+	},
+	{
+		name:       "peer_churn",
+		collectors: []string{"peers"},
+		cycles:     []string{"", "testdata/fixtures/peer_churn/2"},
+		metrics: []string{
+			"radix_peers_connected_total",
+			"radix_peers_disconnected_total",
+			"radix_peers_session_age_seconds_avg",
+		},
+	},
+	{
+		name:       "stake_trend",
+		collectors: []string{"epochproof"},
+		cycles:     []string{"", "testdata/fixtures/stake_trend/2", "testdata/fixtures/stake_trend/3"},
+		metrics: []string{
+			"radix_validator_next_validators_stake_min_avg",
+			"radix_validator_next_validators_stake_min_growth_per_epoch",
+		},
+	},
+}
+
+func TestCollectors(t *testing.T) {
+	for _, fixture := range collectorFixtures {
+		fixture := fixture
+		t.Run(fixture.name, func(t *testing.T) {
+			testCollectorFixture(t, fixture)
+		})
+	}
+}
+
+// testCollectorFixture runs fixture with a target of its own, state
+// included, and compares its metrics with the golden file.
+func testCollectorFixture(t *testing.T, fixture collectorFixture) {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	target := newTargetWithTransport(fixture.name, "http://fixtures", 0, registry, fixtureTransport{})
+	target.state = &targetState{}
+	if fixture.setup != nil {
+		fixture.setup(t, target)
+	}
+
+	realClock := clock
+	defer func() { clock = realClock }()
+
+	cycles := fixture.cycles
+	if len(cycles) == 0 {
+		cycles = []string{""}
+	}
+	for i, dir := range cycles {
+		at := fixtureTime.Add(time.Duration(i) * fixtureInterval)
+		clock = func() time.Time { return at }
+
+		dirs := []string{"testdata/fixtures"}
+		if dir != "" {
+			dirs = append([]string{dir}, dirs...)
+		}
+		target.useTransport(fixtureTransport{dirs: dirs})
+
+		target.resetCycle()
+		succeeded := map[string]bool{}
+		for _, name := range fixture.collectors {
+			err := collectorNamed(t, name).collect(target)
+			if err != nil {
+				t.Fatalf("cycle %d: %v", i+1, err)
+			}
+			succeeded[name] = true
+		}
+		target.setSucceeded(succeeded)
+	}
+
+	golden := filepath.Join("testdata/fixtures", fixture.name+".prom")
+	gatherer := withoutEmptyHelp{registry}
+	if *update {
+		families, gatherErr := gatherer.Gather()
+		if gatherErr != nil {
+			t.Fatal(gatherErr)
+		}
+		var text bytes.Buffer
+		for _, family := range families {
+			if containsName(fixture.metrics, family.GetName()) {
+				expfmt.MetricFamilyToText(&text, family)
+			}
+		}
+		writeErr := ioutil.WriteFile(golden, text.Bytes(), 0644)
+		if writeErr != nil {
+			t.Fatal(writeErr)
+		}
+	}
+
+	expected, openErr := os.Open(golden)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	defer expected.Close()
+
+	compareErr := testutil.GatherAndCompare(gatherer, expected, fixture.metrics...)
+	if compareErr != nil {
+		t.Errorf("%s: %v", golden, compareErr)
+	}
+}
+
+// withoutEmptyHelp drops the empty help most /system/info gauges have, as
+// the text format parser of the golden files does.
+type withoutEmptyHelp struct {
+	gatherer prometheus.Gatherer
+}
+
+func (g withoutEmptyHelp) Gather() ([]*dto.MetricFamily, error) {
+	families, gatherErr := g.gatherer.Gather()
+	for _, family := range families {
+		if family.GetHelp() == "" {
+			family.Help = nil
+		}
+	}
+	return families, gatherErr
+}
+
+func collectorNamed(t *testing.T, name string) *collector {
+	for _, c := range collectors {
+		if c.name == name {
+			return c
+		}
+	}
+	t.Fatalf("no collector %s", name)
+	return nil
+}
+
+// bodyTransport answers every request with body.
+type bodyTransport []byte
+
+func (body bodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// scaledFixture is the fixture of name with its content changed by scale,
+// e.g. to the size of a busy mainnet node's responses.
+func scaledFixture(b *testing.B, name string, scale func(doc interface{}) interface{}) []byte {
+	data, readErr := ioutil.ReadFile(filepath.Join("testdata/fixtures", name))
+	if readErr != nil {
+		b.Fatal(readErr)
+	}
+	var doc interface{}
+	jsonErr := json.Unmarshal(data, &doc)
+	if jsonErr != nil {
+		b.Fatal(jsonErr)
+	}
+	scaled, _ := json.Marshal(scale(doc))
+	return scaled
+}
+
+// BenchmarkSystemPeers collects a list of 500 peers, copies of the
+// fixture's under addresses of their own.
+func BenchmarkSystemPeers(b *testing.B) {
+	body := scaledFixture(b, "system_peers.json", func(doc interface{}) interface{} {
+		peers := doc.([]interface{})
+		var scaled []interface{}
+		for i := 0; i < 500; i++ {
+			peer := map[string]interface{}{}
+			for k, v := range peers[i%len(peers)].(map[string]interface{}) {
+				peer[k] = v
+			}
+			peer["address"] = fmt.Sprintf("rn1qkey%010d", i)
+			scaled = append(scaled, peer)
+		}
+		return scaled
+	})
+
+	target := newTargetWithTransport("", "http://fixtures", 0, prometheus.NewRegistry(), bodyTransport(body))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := systemPeers(target)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// infoWithCounters is the /system/info fixture with 300 more counters.
+func infoWithCounters(b *testing.B) []byte {
+	return scaledFixture(b, "system_info.json", func(doc interface{}) interface{} {
+		counters := doc.(map[string]interface{})["info"].(map[string]interface{})["counters"].(map[string]interface{})
+		for i := 0; i < 30; i++ {
+			group := map[string]interface{}{}
+			for j := 0; j < 10; j++ {
+				group[fmt.Sprintf("counter_%d", j)] = float64(i*10 + j)
+			}
+			counters[fmt.Sprintf("group_%d", i)] = group
+		}
+		return doc
+	})
+}
+
+func BenchmarkWalkNumbers(b *testing.B) {
+	doc := gjson.ParseBytes(infoWithCounters(b))
+	count := 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		walkNumbers(doc, "radix_", func(name []byte, v float64) {
+			count++
+		})
+	}
+}
+
+func BenchmarkSystemInfo(b *testing.B) {
+	target := newTargetWithTransport("", "http://fixtures", 0, prometheus.NewRegistry(), bodyTransport(infoWithCounters(b)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := systemInfo(target)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+// validatorComparison is a row of the compare report.
+type validatorComparison struct {
+	Rank            int     `json:"rank"`
+	Address         string  `json:"address"`
+	Name            string  `json:"name"`
+	Stake           float64 `json:"stake"`
+	FeePercent      float64 `json:"fee_percent"`
+	UptimePercent   float64 `json:"uptime_percent"`
+	ProposalsMade   int64   `json:"proposals_made"`
+	ProposalsMissed int64   `json:"proposals_missed"`
+}
+
+// compareCommand runs compare --addresses a,b,c, returning the exit code.
+// It ranks all validators by stake on the gateway and reports the given
+// ones, e.g. to benchmark a validator against others.
+func compareCommand(args []string) int {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	addresses := flags.String("addresses", "", "Comma separated validator addresses to compare")
+	gateway := flags.String("gateway", "https://mainnet.radixdlt.com", "Gateway API base url")
+	asJson := flags.Bool("json", false, "Print JSON rather than a table")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return 2
+	}
+	if *addresses == "" || flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: ./main compare --addresses a,b,c [--gateway url] [--json]")
+		return 2
+	}
+
+	rows, compareErr := compareValidators(*gateway, strings.Split(*addresses, ","))
+	if compareErr != nil {
+		fmt.Fprintln(os.Stderr, compareErr)
+		return 1
+	}
+
+	if *asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(rows)
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "RANK\tNAME\tSTAKE\tFEE %\tUPTIME %\tMISSED\tADDRESS\t")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%d\t%s\t%.0f\t%.2f\t%.2f\t%d\t%s\t\n", row.Rank, row.Name, row.Stake, row.FeePercent, row.UptimePercent, row.ProposalsMissed, row.Address)
+	}
+	w.Flush()
+	return 0
+}
+
+// compareValidators pulls every validator from the gateway to rank them by
+// stake, and the proposal uptime of the requested ones.
+func compareValidators(gateway string, addresses []string) ([]validatorComparison, error) {
+	t := newTarget("", gateway, 0, prometheus.NewRegistry())
+
+	var all []validatorComparison
+	cursor := ""
+	for {
+		payload := []byte("{}")
+		if cursor != "" {
+			payload, _ = json.Marshal(map[string]string{"cursor": cursor})
+		}
+		page, listErr := t.fetchFrom(gateway, "POST", "/state/validators/list", payload, nil)
+		if listErr != nil {
+			return nil, listErr
+		}
+
+		gjson.GetBytes(page, "validators.items").ForEach(func(_, v gjson.Result) bool {
+			row := validatorComparison{
+				Address:    v.Get("address").String(),
+				Stake:      v.Get("stake_vault.balance").Float(),
+				FeePercent: v.Get("effective_fee_factor.current.fee_factor").Float() * 100,
+			}
+			v.Get("metadata.items").ForEach(func(_, item gjson.Result) bool {
+				if item.Get("key").String() == "name" {
+					row.Name = item.Get("value.typed.value").String()
+					return false
+				}
+				return true
+			})
+			all = append(all, row)
+			return true
+		})
+
+		cursor = gjson.GetBytes(page, "validators.next_cursor").String()
+		if cursor == "" {
+			break
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Stake > all[j].Stake })
+	byAddress := map[string]*validatorComparison{}
+	for i := range all {
+		all[i].Rank = i + 1
+		byAddress[all[i].Address] = &all[i]
+	}
+
+	var rows []validatorComparison
+	var unknown []string
+	for _, address := range addresses {
+		row, found := byAddress[strings.TrimSpace(address)]
+		if !found {
+			unknown = append(unknown, address)
+			continue
+		}
+		rows = append(rows, *row)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("not validators on %s: %s", gateway, strings.Join(unknown, ", "))
+	}
+
+	var requested []string
+	for _, row := range rows {
+		requested = append(requested, row.Address)
+	}
+	payload, _ := json.Marshal(map[string]interface{}{"validator_addresses": requested})
+	uptime, uptimeErr := t.fetchFrom(gateway, "POST", "/statistics/validators/uptime", payload, nil)
+	if uptimeErr != nil {
+		return nil, uptimeErr
+	}
+	gjson.GetBytes(uptime, "validators.items").ForEach(func(_, u gjson.Result) bool {
+		for i := range rows {
+			if rows[i].Address == u.Get("address").String() {
+				rows[i].ProposalsMade = u.Get("proposals_made_count").Int()
+				rows[i].ProposalsMissed = u.Get("proposals_missed_count").Int()
+				if proposals := rows[i].ProposalsMade + rows[i].ProposalsMissed; proposals > 0 {
+					rows[i].UptimePercent = 100 * float64(rows[i].ProposalsMade) / float64(proposals)
+				}
+			}
+		}
+		return true
+	})
+
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Rank < rows[j].Rank })
+	return rows, nil
+}
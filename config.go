@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+// config is the content of the -config file, e.g.
+//
+//	networks:
+//	  - name: mainnet
+//	    url: http://localhost:3333
+//	    interval: 1m
+//	    labels:
+//	      env: production
+//	    headers:
+//	      CF-Access-Client-Id: ${CF_CLIENT_ID}
+//	      CF-Access-Client-Secret: ${CF_CLIENT_SECRET}
+//	    cookies: true
+//	    gateway: https://mainnet.radixdlt.com
+//	    fallbacks:
+//	      - http://backup-node:3333
+//	  - name: stokenet
+//	    interval: 5m
+//	    nodes:
+//	      - name: validator
+//	        url: http://stokenet-validator:3333
+//	        labels:
+//	          provider: hetzner
+//	          region: eu-central
+//	      - name: backup
+//	        url: http://stokenet-backup:3333
+//	        labels:
+//	          provider: aws
+//	          region: us-east-1
+//	meta_labels:
+//	  - name: network_id
+//	    endpoint: /system/info
+//	    path: info.configuration.networkId
+//	delegators:
+//	  export: hashed
+//	  salt: ${DELEGATOR_SALT}
+//	slo:
+//	  gateway: https://olympia-gateway.example.com
+//	  proposals: 99.5
+//	  window: 720h
+//	exec:
+//	  - name: ledger_backup
+//	    command: [/usr/local/bin/backup-age, --json]
+//	    format: json
+//	    timeout: 10s
+//
+// Without networks, the node given by -b is collected from. A network
+// either has a url, or several nodes which are compared with each other.
+// Labels of a node, e.g. where it is hosted, add to and override those of
+// its network.
+type config struct {
+	Networks   []networkConfig `yaml:"networks"`
+	MetaLabels []metaLabel     `yaml:"meta_labels"`
+	Delegators delegatorExport `yaml:"delegators"`
+	SLO        *sloConfig      `yaml:"slo"`
+	Exec       []execCommand   `yaml:"exec"`
+}
+
+var labelNameRE = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+type networkConfig struct {
+	Name      string            `yaml:"name"`
+	Url       string            `yaml:"url"`
+	Interval  time.Duration     `yaml:"interval"`
+	Labels    map[string]string `yaml:"labels"`
+	Headers   map[string]string `yaml:"headers"`
+	Cookies   bool              `yaml:"cookies"`
+	Gateway   string            `yaml:"gateway"`
+	Fallbacks []string          `yaml:"fallbacks"`
+	Nodes     []nodeConfig      `yaml:"nodes"`
+}
+
+type nodeConfig struct {
+	Name      string            `yaml:"name"`
+	Url       string            `yaml:"url"`
+	Labels    map[string]string `yaml:"labels"`
+	Fallbacks []string          `yaml:"fallbacks"`
+}
+
+func loadConfig(file string) (*config, error) {
+	data, readErr := ioutil.ReadFile(file)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	var cfg config
+	yamlErr := yaml.UnmarshalStrict(data, &cfg)
+	if yamlErr != nil {
+		return nil, fmt.Errorf("%s: %v", file, yamlErr)
+	}
+
+	names := map[string]bool{}
+	for _, n := range cfg.Networks {
+		if n.Name == "" || (n.Url == "") == (len(n.Nodes) == 0) {
+			return nil, fmt.Errorf("%s: every network needs a name, and either a url or nodes", file)
+		}
+		if names[n.Name] {
+			return nil, fmt.Errorf("%s: network %s is configured twice", file, n.Name)
+		}
+		names[n.Name] = true
+
+		labelErr := checkLabels(n.Labels)
+		if labelErr != nil {
+			return nil, fmt.Errorf("%s: network %s: %v", file, n.Name, labelErr)
+		}
+
+		urlErr := n.checkUrls()
+		if urlErr != nil {
+			return nil, fmt.Errorf("%s: network %s: %v", file, n.Name, urlErr)
+		}
+
+		nodeNames := map[string]bool{}
+		for _, node := range n.Nodes {
+			if node.Name == "" || node.Url == "" || nodeNames[node.Name] {
+				return nil, fmt.Errorf("%s: network %s: every node needs a unique name and a url", file, n.Name)
+			}
+			nodeNames[node.Name] = true
+
+			labelErr := checkLabels(node.Labels)
+			if labelErr != nil {
+				return nil, fmt.Errorf("%s: network %s: node %s: %v", file, n.Name, node.Name, labelErr)
+			}
+		}
+	}
+
+	metaNames := map[string]bool{}
+	for _, m := range cfg.MetaLabels {
+		if !labelNameRE.MatchString(m.Name) || m.Endpoint == "" || m.Path == "" {
+			return nil, fmt.Errorf("%s: every meta label needs a valid name, an endpoint and a path", file)
+		}
+		if metaNames[m.Name] {
+			return nil, fmt.Errorf("%s: meta label %s is configured twice", file, m.Name)
+		}
+		metaNames[m.Name] = true
+
+		for _, n := range cfg.Networks {
+			_, found := n.Labels[m.Name]
+			for _, node := range n.Nodes {
+				_, onNode := node.Labels[m.Name]
+				found = found || onNode
+			}
+			if found || m.Name == "network" || m.Name == "node" {
+				return nil, fmt.Errorf("%s: meta label %s is also a network label", file, m.Name)
+			}
+		}
+	}
+
+	if cfg.SLO != nil {
+		sloErr := cfg.SLO.validate()
+		if sloErr != nil {
+			return nil, fmt.Errorf("%s: %v", file, sloErr)
+		}
+	}
+
+	execNames := map[string]bool{}
+	for _, c := range cfg.Exec {
+		if !labelNameRE.MatchString(c.Name) || len(c.Command) == 0 || execNames[c.Name] {
+			return nil, fmt.Errorf("%s: every exec command needs a unique valid name and a command", file)
+		}
+		if c.Format != "" && c.Format != "json" && c.Format != "prometheus" {
+			return nil, fmt.Errorf("%s: exec %s: format must be json or prometheus", file, c.Name)
+		}
+		execNames[c.Name] = true
+	}
+
+	cfg.Delegators.Salt = os.ExpandEnv(cfg.Delegators.Salt)
+	addSecret(cfg.Delegators.Salt)
+	switch cfg.Delegators.Export {
+	case "", "truncated":
+	case "hashed":
+		if cfg.Delegators.Salt == "" {
+			return nil, fmt.Errorf("%s: hashed delegators need a salt", file)
+		}
+	default:
+		return nil, fmt.Errorf("%s: delegators export must be truncated or hashed", file)
+	}
+
+	return &cfg, nil
+}
+
+// checkUrls runs checkBaseUrl on the node and gateway urls of n.
+func (n networkConfig) checkUrls() error {
+	urls := append([]string{n.Url, n.Gateway}, n.Fallbacks...)
+	for _, node := range n.Nodes {
+		urls = append(urls, node.Url)
+		urls = append(urls, node.Fallbacks...)
+	}
+	for _, u := range urls {
+		if u == "" {
+			continue
+		}
+		urlErr := checkBaseUrl(u)
+		if urlErr != nil {
+			return urlErr
+		}
+	}
+	return nil
+}
+
+// checkLabels refuses labels of a network or node the exporter sets itself.
+func checkLabels(labels map[string]string) error {
+	for name := range labels {
+		if name == "network" || name == "node" {
+			return fmt.Errorf("the %s label is set from its name", name)
+		}
+		if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("%s is not a valid label name", name)
+		}
+	}
+	return nil
+}
+
+// targets creates a target per node of every network. Their metrics are
+// labelled with the network name, the node name and the labels of the
+// network and node.
+// A metric must have the same label names everywhere, so labels missing on
+// a network are left empty, as is the node label of single node networks.
+func (cfg *config) targets(baseUrl string, defaultInterval time.Duration) []*target {
+	if len(cfg.Networks) == 0 {
+		t := newTarget("", baseUrl, defaultInterval, registry)
+		t.setMetaLabels(cfg.MetaLabels)
+		t.setDelegatorExport(cfg.Delegators)
+		t.execCommands = cfg.Exec
+		if cfg.SLO != nil {
+			t.setSLO(cfg.SLO)
+		}
+		return []*target{t}
+	}
+
+	labelNames := map[string]bool{}
+	for _, n := range cfg.Networks {
+		for k := range n.Labels {
+			labelNames[k] = true
+		}
+		if len(n.Nodes) > 0 {
+			labelNames["node"] = true
+		}
+		for _, node := range n.Nodes {
+			for k := range node.Labels {
+				labelNames[k] = true
+			}
+		}
+	}
+
+	var targets []*target
+	for _, n := range cfg.Networks {
+		labels := prometheus.Labels{"network": n.Name}
+		for k := range labelNames {
+			labels[k] = n.Labels[k]
+		}
+
+		interval := n.Interval
+		if interval == 0 {
+			interval = defaultInterval
+		}
+
+		nodes := n.Nodes
+		if len(nodes) == 0 {
+			nodes = []nodeConfig{{Url: n.Url, Fallbacks: n.Fallbacks}}
+		}
+
+		var f *fleet
+		if len(nodes) > 1 {
+			fleetLabels := prometheus.Labels{}
+			for k, v := range labels {
+				if k != "node" {
+					fleetLabels[k] = v
+				}
+			}
+			f = newFleet(wrapRegisterer(fleetLabels, registry))
+		}
+
+		for _, node := range nodes {
+			name := n.Name
+			nodeLabels := prometheus.Labels{}
+			for k, v := range labels {
+				nodeLabels[k] = v
+			}
+			for k, v := range node.Labels {
+				nodeLabels[k] = v
+			}
+			if node.Name != "" {
+				name += "/" + node.Name
+				nodeLabels["node"] = node.Name
+			}
+
+			registerer := wrapRegisterer(nodeLabels, registry)
+			t := newTarget(name, node.Url, interval, registerer)
+			t.labels = nodeLabels
+			t.fallbacks = node.Fallbacks
+			t.setMetaLabels(cfg.MetaLabels)
+			t.setDelegatorExport(cfg.Delegators)
+			t.execCommands = cfg.Exec
+			if cfg.SLO != nil {
+				t.setSLO(cfg.SLO)
+			}
+			if len(n.Headers) > 0 {
+				t.headers = map[string]string{}
+				for name, value := range n.Headers {
+					t.headers[name] = os.ExpandEnv(value)
+					addSecret(t.headers[name])
+				}
+			}
+			if n.Cookies {
+				t.keepCookies()
+			}
+			if n.Gateway != "" {
+				t.setGateway(n.Gateway)
+			}
+			if f != nil {
+				f.join(t)
+			}
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
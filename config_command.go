@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Flags that end up in the networks of the effective configuration
+var networkFlags = map[string]bool{
+	"b": true, "config": true, "header": true, "cookies": true,
+	"fallback": true, "gateway": true, "interval": true,
+}
+
+// effectiveConfig is what config print renders: the -config file with the
+// network flags and environment variables applied, and every other flag.
+type effectiveConfig struct {
+	config `yaml:",inline"`
+	Flags  map[string]string `yaml:"flags"`
+}
+
+// configCommand runs config print or config check, returning the exit code.
+// defaults holds the network flags, which apply wherever the -config file
+// leaves them out.
+func configCommand(command, configFile string, defaults networkConfig) int {
+	cfg := &config{}
+	if configFile != "" {
+		var cfgErr error
+		cfg, cfgErr = loadConfig(configFile)
+		if cfgErr != nil {
+			fmt.Fprintln(os.Stderr, cfgErr)
+			return 1
+		}
+	}
+	effective := cfg.effective(defaults)
+
+	switch command {
+	case "print":
+		out, yamlErr := yaml.Marshal(effective)
+		if yamlErr != nil {
+			fmt.Fprintln(os.Stderr, yamlErr)
+			return 1
+		}
+		fmt.Print(maskPatterns(string(out)))
+		return 0
+	case "check":
+		checkErr := effective.check()
+		if checkErr != nil {
+			fmt.Fprintln(os.Stderr, checkErr)
+			return 1
+		}
+		fmt.Println("configuration is valid")
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown config command %q, expected print or check\n", command)
+		return 2
+	}
+}
+
+// effective merges cfg with the flags the same way main does when creating
+// targets.
+func (cfg *config) effective(defaults networkConfig) effectiveConfig {
+	effective := effectiveConfig{config: *cfg, Flags: map[string]string{}}
+
+	if len(cfg.Networks) == 0 {
+		effective.Networks = []networkConfig{defaults}
+	} else {
+		effective.Networks = nil
+		for _, n := range cfg.Networks {
+			if n.Interval == 0 {
+				n.Interval = defaults.Interval
+			}
+			if len(n.Headers) == 0 {
+				n.Headers = defaults.Headers
+			}
+			n.Cookies = n.Cookies || defaults.Cookies
+			if n.Gateway == "" {
+				n.Gateway = defaults.Gateway
+			}
+			effective.Networks = append(effective.Networks, n)
+		}
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if !networkFlags[f.Name] {
+			effective.Flags[f.Name] = f.Value.String()
+		}
+	})
+	effective.maskSecrets()
+	return effective
+}
+
+// maskSecrets replaces the values of the fields holding secrets, so the
+// effective configuration can be shared.
+func (effective *effectiveConfig) maskSecrets() {
+	for i, n := range effective.Networks {
+		masked := map[string]string{}
+		for name := range n.Headers {
+			masked[name] = "REDACTED"
+		}
+		if len(masked) > 0 {
+			effective.Networks[i].Headers = masked
+		}
+	}
+	if effective.Delegators.Salt != "" {
+		effective.Delegators.Salt = "REDACTED"
+	}
+	if effective.Flags["debug-token"] != "" {
+		effective.Flags["debug-token"] = "REDACTED"
+	}
+}
+
+// check reports what main would refuse to start with beyond the -config
+// file itself being invalid.
+func (effective effectiveConfig) check() error {
+	looping := effective.Networks[0].Interval > 0
+	for _, n := range effective.Networks {
+		if (n.Interval > 0) != looping {
+			return fmt.Errorf("either all networks or none must have a collection interval")
+		}
+		urlErr := n.checkUrls()
+		if urlErr != nil {
+			return urlErr
+		}
+	}
+
+	if effective.Flags["epoch-aligned"] == "true" && !looping {
+		return fmt.Errorf("-epoch-aligned requires -interval")
+	}
+	if effective.SLO != nil && !looping && effective.Flags["listen"] == "" && effective.Flags["state"] == "" {
+		return fmt.Errorf("slo without -interval or -listen requires -state, to keep the proposal history between runs")
+	}
+	if effective.Flags["ssh"] != "" && effective.Flags["ssh-key"] == "" {
+		return fmt.Errorf("-ssh needs -ssh-key")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// peerConnectivity joins the peers with the active validator set, to tell
+// how much of the stake the node talks to directly. The node's own
+// validator counts as connected.
+func peerConnectivity(t *target) error {
+	if t.peers == nil || len(t.validatorStakes) == 0 {
+		return errors.New("no peers or validator set, as /system/peers or /system/epochproof failed")
+	}
+
+	self := nodeKey(t.validatorAddress)
+
+	var total, connected float64
+	var count int
+	for key, stake := range t.validatorStakes {
+		total += stake
+		if t.peers[key] || key == self {
+			connected += stake
+			count++
+		}
+	}
+
+	t.peersValidatorsConnected.Set(float64(count))
+	if total > 0 {
+		t.peersValidatorStakeRatio.Set(connected / total)
+	}
+	return nil
+}
+
+// nodeKey reduces a bech32 node or validator address to the part encoding
+// the public key. Node (rn1..., tn1...) and validator (rv1..., tv1...)
+// addresses of the same key only differ in their prefix and checksum.
+func nodeKey(address string) string {
+	sep := strings.LastIndexByte(address, '1')
+	if sep < 0 || len(address)-sep-1 < 6 {
+		return address
+	}
+	return address[sep+1 : len(address)-6]
+}
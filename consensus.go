@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+// consensusCounters are the /system/info counters that lead consensus
+// memory pressure, under names that do not change with the node's JSON.
+// Counters the node does not have are left out.
+var consensusCounters = []struct {
+	name      string
+	help      string
+	path      string
+	valueType prometheus.ValueType
+}{
+	{"radix_consensus_vertex_store_size", "Count of vertices in the BFT vertex store", "info.counters.bft.vertex_store.size", prometheus.GaugeValue},
+	{"radix_consensus_vertex_store_forks", "Count of forks in the BFT vertex store", "info.counters.bft.vertex_store.forks", prometheus.GaugeValue},
+	{"radix_consensus_vertex_store_rebuilds_total", "Count of BFT vertex store rebuilds since the node started", "info.counters.bft.vertex_store.rebuilds", prometheus.CounterValue},
+	{"radix_consensus_queued_events", "Count of consensus events queued by the epoch manager, e.g. for a future epoch", "info.counters.epoch_manager.queued_consensus_events", prometheus.GaugeValue},
+	{"radix_sync_state_versions_behind", "Count of ledger state versions the node is behind its sync target", "info.counters.sync.target_current_diff", prometheus.GaugeValue},
+}
+
+// consensusDepth exports the consensusCounters of info.
+func (t *target) consensusDepth(info gjson.Result) {
+	var metrics []Metric
+	for _, c := range consensusCounters {
+		v := info.Get(c.path)
+		if v.Exists() {
+			metrics = append(metrics, Metric{Name: c.name, Help: c.help, Type: c.valueType, Value: v.Float()})
+		}
+	}
+	t.setPluginMetrics("info/consensus", "/system/info", metrics)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// sample is one line of a textfile, as convert outputs it.
+type sample struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	Labels      map[string]string `json:"labels"`
+	Value       sampleValue       `json:"value"`
+	TimestampMs int64             `json:"timestamp_ms,omitempty"`
+}
+
+// sampleValue is a number in JSON, except NaN and infinities, which JSON
+// lacks. Those are the strings the text format has for them.
+type sampleValue float64
+
+func (v sampleValue) MarshalJSON() ([]byte, error) {
+	f := float64(v)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return json.Marshal(formatValue(f))
+	}
+	return json.Marshal(f)
+}
+
+func formatValue(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// convertCommand runs convert file.prom --to json|csv, returning the exit
+// code. It reads textfiles written by any version, for scripts that would
+// rather not parse the text format.
+func convertCommand(args []string) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	to := flags.String("to", "json", "Format to convert to, json or csv")
+
+	// Allow the flags on either side of the file
+	var files []string
+	for {
+		if parseErr := flags.Parse(args); parseErr != nil {
+			return 2
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		files = append(files, args[0])
+		args = args[1:]
+	}
+	if len(files) != 1 || (*to != "json" && *to != "csv") {
+		fmt.Fprintln(os.Stderr, "Usage: ./main convert file.prom [--to json|csv]")
+		return 2
+	}
+
+	in, openErr := os.Open(files[0])
+	if openErr != nil {
+		fmt.Fprintln(os.Stderr, openErr)
+		return 1
+	}
+	defer in.Close()
+
+	var parser expfmt.TextParser
+	families, parseErr := parser.TextToMetricFamilies(in)
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", files[0], parseErr)
+		return 1
+	}
+	samples := toSamples(families)
+
+	if *to == "csv" {
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"name", "type", "labels", "value", "timestamp_ms"})
+		for _, s := range samples {
+			var labels []string
+			for _, name := range sortedKeys(s.Labels) {
+				labels = append(labels, name+"="+strconv.Quote(s.Labels[name]))
+			}
+			timestamp := ""
+			if s.TimestampMs != 0 {
+				timestamp = strconv.FormatInt(s.TimestampMs, 10)
+			}
+			w.Write([]string{s.Name, s.Type, strings.Join(labels, ","), formatValue(float64(s.Value)), timestamp})
+		}
+		w.Flush()
+		if w.Error() != nil {
+			fmt.Fprintln(os.Stderr, w.Error())
+			return 1
+		}
+		return 0
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encodeErr := encoder.Encode(samples)
+	if encodeErr != nil {
+		fmt.Fprintln(os.Stderr, encodeErr)
+		return 1
+	}
+	return 0
+}
+
+// toSamples lists the samples of families by name, expanding histograms
+// and summaries into their _bucket, _sum and _count series like the text
+// format does.
+func toSamples(families map[string]*dto.MetricFamily) []sample {
+	samples := []sample{}
+	for _, name := range sortedFamilies(families) {
+		family := families[name]
+		typ := strings.ToLower(family.GetType().String())
+
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, pair := range m.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			add := func(suffix string, value float64, extra ...string) {
+				s := sample{Name: name + suffix, Type: typ, Labels: map[string]string{}, Value: sampleValue(value), TimestampMs: m.GetTimestampMs()}
+				for k, v := range labels {
+					s.Labels[k] = v
+				}
+				if len(extra) == 2 {
+					s.Labels[extra[0]] = extra[1]
+				}
+				samples = append(samples, s)
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				for _, q := range m.GetSummary().GetQuantile() {
+					add("", q.GetValue(), "quantile", formatValue(q.GetQuantile()))
+				}
+				add("_sum", m.GetSummary().GetSampleSum())
+				add("_count", float64(m.GetSummary().GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				buckets := m.GetHistogram().GetBucket()
+				for _, b := range buckets {
+					add("_bucket", float64(b.GetCumulativeCount()), "le", formatValue(b.GetUpperBound()))
+				}
+				if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].GetUpperBound(), 1) {
+					add("_bucket", float64(m.GetHistogram().GetSampleCount()), "le", "+Inf")
+				}
+				add("_sum", m.GetHistogram().GetSampleSum())
+				add("_count", float64(m.GetHistogram().GetSampleCount()))
+			}
+		}
+	}
+	return samples
+}
+
+func sortedFamilies(families map[string]*dto.MetricFamily) []string {
+	var names []string
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	serveMux = http.NewServeMux()
+
+	// Raw responses of the node API, for diagnosing parse discrepancies
+	responses = &responseRecorder{entries: map[string][]recordedResponse{}}
+
+	debugToken string
+)
+
+func init() {
+	serveMux.HandleFunc("/debug/responses/", debugResponses)
+}
+
+type recordedResponse struct {
+	Time   time.Time `json:"time"`
+	Url    string    `json:"url"`
+	Status int       `json:"status"`
+	Body   string    `json:"body"`
+}
+
+// responseRecorder keeps the last size responses of every endpoint. With
+// several networks configured, endpoints are prefixed with the network name.
+type responseRecorder struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string][]recordedResponse
+}
+
+func (rr *responseRecorder) record(network string, r *http.Response, body []byte) {
+	if rr.size <= 0 {
+		return
+	}
+
+	endpoint := strings.Trim(path.Join(network, r.Request.URL.Path), "/")
+	entry := recordedResponse{
+		Time:   time.Now(),
+		Url:    r.Request.URL.String(),
+		Status: r.StatusCode,
+		Body:   string(body),
+	}
+
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	list := rr.entries[endpoint]
+	if len(list) < rr.size {
+		list = append(list, entry)
+	} else {
+		copy(list, list[1:])
+		list[len(list)-1] = entry
+	}
+	rr.entries[endpoint] = list
+}
+
+// get returns the recorded responses of endpoint, oldest first.
+func (rr *responseRecorder) get(endpoint string) ([]recordedResponse, bool) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	list, found := rr.entries[endpoint]
+	return append([]recordedResponse(nil), list...), found
+}
+
+func (rr *responseRecorder) endpoints() []string {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	names := make([]string, 0, len(rr.entries))
+	for name := range rr.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// debugResponses serves /debug/responses/ with the list of endpoints, and
+// /debug/responses/<endpoint> with the responses recorded for it.
+func debugResponses(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var result interface{}
+
+	endpoint := strings.Trim(strings.TrimPrefix(r.URL.Path, "/debug/responses/"), "/")
+	if endpoint == "" {
+		result = responses.endpoints()
+	} else {
+		list, found := responses.get(endpoint)
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		result = list
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// authorized checks the request's bearer token against -debug-token. Debug
+// endpoints are disabled altogether when no token is configured.
+func authorized(r *http.Request) bool {
+	if debugToken == "" {
+		return false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(debugToken)) == 1
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// delegatorExport configures radix_validator_delegator_stake. Delegator
+// addresses are never exported in full: they are either truncated, or
+// replaced by a pseudonym keyed with salt so they can't be looked up.
+type delegatorExport struct {
+	Export string `yaml:"export"`
+	Salt   string `yaml:"salt"`
+	Length int    `yaml:"length"`
+}
+
+func (t *target) setDelegatorExport(d delegatorExport) {
+	if d.Export == "" {
+		return
+	}
+
+	t.delegators = d
+	t.delegatorStake = newGaugeVec(prometheus.GaugeOpts{
+		Name: "radix_validator_delegator_stake",
+		Help: "Stake per delegator in XRD, by truncated or hashed delegator address",
+	}, []string{"delegator"})
+	t.registerFor("validator", "/node/validator", t.delegatorStake)
+}
+
+// label returns the label value standing in for a delegator address.
+// Truncated addresses keep Length characters past their common prefix, and
+// can still collide, so stakes are added up per label.
+func (d delegatorExport) label(address string) string {
+	length := d.Length
+	if length <= 0 {
+		length = 12
+	}
+
+	if d.Export == "hashed" {
+		mac := hmac.New(sha256.New, []byte(d.Salt))
+		mac.Write([]byte(address))
+		address = hex.EncodeToString(mac.Sum(nil))
+	} else {
+		length += accountPrefixLength(address)
+	}
+
+	if len(address) > length {
+		address = address[:length]
+	}
+	return address
+}
+
+// accountPrefixLength is the length of what all account addresses of a
+// network start with, e.g. rdx1qsp on mainnet: the network's prefix, the
+// separator, and the key type every account address encodes the same way.
+func accountPrefixLength(address string) int {
+	separator := strings.LastIndex(address, "1")
+	if separator < 0 || !strings.HasPrefix(address[separator+1:], "qsp") {
+		return 0
+	}
+	return separator + 1 + len("qsp")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// currentEpoch reads the epoch of the latest ledger proof. /system/proof is
+// a lot lighter than /system/epochproof, so it is cheap enough to poll often.
+func currentEpoch(t *target) (int64, error) {
+	body, getErr := t.pollData("/system/proof")
+	if getErr != nil {
+		return 0, getErr
+	}
+
+	return gjson.GetBytes(body, "header.epoch").Int(), nil
+}
+
+// watchEpoch polls the node of t every poll interval and sends the new epoch
+// number on the returned channel whenever it changes.
+func watchEpoch(t *target, poll time.Duration) <-chan int64 {
+	changes := make(chan int64)
+
+	go func() {
+		var last int64
+		for ; ; time.Sleep(poll) {
+			epoch, err := currentEpoch(t)
+			if err != nil {
+				log.Print(t.logPrefix(), err)
+				continue
+			}
+
+			if last != 0 && epoch != last {
+				changes <- epoch
+			}
+			last = epoch
+		}
+	}()
+
+	return changes
+}
+
+// recordEpoch remembers when the epoch last changed. The epoch proof
+// carries the time of the change in milliseconds, else the time the change
+// was first seen stands in for it.
+func (t *target) recordEpoch(epoch int64, proofTimestamp float64) {
+	if epoch == 0 {
+		return
+	}
+
+	changed := float64(clock().Unix())
+	if proofTimestamp > 0 {
+		changed = proofTimestamp / 1000
+	}
+
+	t.updateState(func(s *targetState) {
+		if epoch != s.Epoch {
+			s.Epoch = epoch
+			s.EpochChangeTime = changed
+		}
+	})
+}
+
+// secondsSinceEpochChange keeps growing while the epoch is stuck, so a
+// consensus halt shows even if other counters keep moving.
+func (t *target) secondsSinceEpochChange() float64 {
+	changed := t.readState(func(s *targetState) float64 { return s.EpochChangeTime })
+	if changed == 0 {
+		return 0
+	}
+	return float64(clock().UnixNano())/1e9 - changed
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/tidwall/gjson"
+)
+
+// execCommand is a command run on every collection, whose output is merged
+// into the metrics, e.g. for host specific checks like the age of the last
+// ledger backup.
+type execCommand struct {
+	Name    string        `yaml:"name"`
+	Command []string      `yaml:"command"`
+	Format  string        `yaml:"format"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+var invalidMetricChars = regexp.MustCompile("[^a-zA-Z0-9_:]")
+
+// execCommands runs the -config exec commands. The numbers of JSON output
+// are named like /system/info ones, and metrics of Prometheus text output
+// keep their names, both under radix_exec_<name>_. A failing command does not fail
+// the collection, as it is not about the node, but shows in
+// radix_exec_success.
+func execCommands(t *target) error {
+	for _, c := range t.execCommands {
+		metrics, runErr := c.run(t)
+		success := 1.0
+		if runErr != nil {
+			t.warn("exec %s: %v", c.Name, runErr)
+			success = 0
+		}
+
+		metrics = append(metrics, Metric{
+			Name:   "radix_exec_success",
+			Help:   "Whether the exec command ran and its output could be parsed",
+			Labels: map[string]string{"command": c.Name},
+			Value:  success,
+		})
+		t.setPluginMetrics("exec/"+c.Name, "exec", metrics)
+	}
+	return nil
+}
+
+// run runs c with the node's url and the network name in RADIX_NODE_URL and
+// RADIX_NETWORK.
+func (c execCommand) run(t *target) ([]Metric, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+	cmd.Env = append(os.Environ(), "RADIX_NODE_URL="+t.currentUrl(), "RADIX_NETWORK="+t.name)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, runErr := cmd.Output()
+	if runErr != nil {
+		return nil, fmt.Errorf("%v: %s", runErr, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	prefix := "radix_exec_" + c.Name + "_"
+	if c.Format == "prometheus" {
+		metrics, parseErr := parsePrometheusText(out)
+		for i := range metrics {
+			if !strings.HasPrefix(metrics[i].Name, prefix) {
+				metrics[i].Name = prefix + metrics[i].Name
+			}
+		}
+		return metrics, parseErr
+	}
+
+	doc := gjson.ParseBytes(out)
+	if !gjson.ValidBytes(out) || !(doc.IsObject() || doc.IsArray()) {
+		return nil, fmt.Errorf("expected a JSON object or array")
+	}
+	var metrics []Metric
+	walkNumbers(doc, prefix, func(name []byte, v float64) {
+		metrics = append(metrics, Metric{
+			Name:  invalidMetricChars.ReplaceAllString(string(name), "_"),
+			Help:  "From the " + c.Name + " exec command",
+			Value: v,
+		})
+	})
+	return metrics, nil
+}
+
+// parsePrometheusText reads the counters, gauges and untyped metrics of
+// out. Summaries and histograms are left out.
+func parsePrometheusText(out []byte) ([]Metric, error) {
+	var parser expfmt.TextParser
+	families, parseErr := parser.TextToMetricFamilies(bytes.NewReader(out))
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	var metrics []Metric
+	for name, family := range families {
+		for _, m := range family.GetMetric() {
+			metric := Metric{Name: name, Help: family.GetHelp(), Labels: map[string]string{}}
+			for _, pair := range m.GetLabel() {
+				metric.Labels[pair.GetName()] = pair.GetValue()
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				metric.Type = prometheus.CounterValue
+				metric.Value = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				metric.Type = prometheus.GaugeValue
+				metric.Value = m.GetGauge().GetValue()
+			case dto.MetricType_UNTYPED:
+				metric.Type = prometheus.UntypedValue
+				metric.Value = m.GetUntyped().GetValue()
+			default:
+				continue
+			}
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics about the exporter itself, so the monitoring pipeline can be
+// monitored too. Per-network collection metrics live on the target.
+var (
+	radix_exporter_start_time_seconds = newGauge(prometheus.GaugeOpts{
+		Name: "radix_exporter_start_time_seconds",
+		Help: "Start time of the exporter process since unix epoch in seconds",
+	})
+)
+
+func init() {
+	registerFrom(registry, "exporter", radix_exporter_start_time_seconds)
+
+	radix_exporter_start_time_seconds.SetToCurrentTime()
+}
+
+// runCollection does one full collection cycle of t and records its outcome.
+// If the node API fails a core collector, the cycle is retried against its
+// fallbacks in turn.
+func runCollection(t *target) error {
+	start := time.Now()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	t.resetWarnings()
+
+	source := "primary"
+	t.useUrl(t.baseUrl)
+	err := collect(t)
+	for _, fallback := range t.fallbacks {
+		if err == nil {
+			break
+		}
+		t.warn("%v, failing over to %s", err, fallback)
+
+		source = "backup"
+		t.useUrl(fallback)
+		err = collect(t)
+	}
+	t.collectionDuration.Observe(time.Since(start).Seconds())
+
+	runtime.ReadMemStats(&after)
+
+	// Counted in the state, so one-shot runs with -state count across runs,
+	// and saved with it before the run may exit on a failure
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	t.updateState(func(s *targetState) {
+		if s.Collections == nil {
+			s.Collections = map[string]float64{}
+		}
+		s.Collections[result]++
+		s.CollectionAllocatedBytes += float64(after.TotalAlloc - before.TotalAlloc)
+		s.CollectionAllocations += float64(after.Mallocs - before.Mallocs)
+	})
+
+	t.setSource(source)
+	if err == nil && source == "backup" {
+		t.backupActive.Set(1)
+	} else {
+		t.backupActive.Set(0)
+	}
+
+	t.recordOutcome(err)
+	if t.reachable() {
+		t.nodeReachable.Set(1)
+	} else {
+		t.nodeReachable.Set(0)
+	}
+
+	saveErr := saveState()
+	if saveErr != nil {
+		log.Print(saveErr)
+	}
+
+	if err != nil {
+		t.useUrl(t.baseUrl)
+		return fmt.Errorf("%s%v", t.logPrefix(), err)
+	}
+	return nil
+}
+
+func (t *target) setSource(source string) {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	t.lastSource = source
+}
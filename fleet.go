@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+// fleet is the nodes of one network, whose ledgers should stay close to
+// each other. Each node reports its own ledger position as it is collected,
+// and is compared with the last one reported by the others.
+type fleet struct {
+	mu      sync.Mutex
+	members []*fleetMember
+
+	stateVersionSpread prometheus.Gauge
+	epochSpread        prometheus.Gauge
+}
+
+type fleetMember struct {
+	target       *target
+	reported     bool
+	stateVersion float64
+	epoch        float64
+	behindLeader prometheus.Gauge
+}
+
+func newFleet(registerer prometheus.Registerer) *fleet {
+	f := &fleet{
+		stateVersionSpread: newGauge(prometheus.GaugeOpts{
+			Name: "radix_fleet_max_state_version_spread",
+			Help: "Difference between the highest and lowest ledger state version of a network's nodes",
+		}),
+		epochSpread: newGauge(prometheus.GaugeOpts{
+			Name: "radix_fleet_max_epoch_spread",
+			Help: "Difference between the highest and lowest epoch of a network's nodes",
+		}),
+	}
+
+	registerFrom(registerer, "/system/proof", f.stateVersionSpread, f.epochSpread)
+	return f
+}
+
+func (f *fleet) join(t *target) {
+	m := &fleetMember{
+		target: t,
+		behindLeader: newGauge(prometheus.GaugeOpts{
+			Name: "radix_fleet_state_version_behind_leader",
+			Help: "Count of ledger state versions the node lags behind the network's most advanced node",
+		}),
+	}
+	t.registerFor("fleet", "/system/proof", m.behindLeader)
+
+	f.members = append(f.members, m)
+	t.fleet = f
+}
+
+// fleetConsistency reports the node's ledger position to its fleet and
+// updates how far apart the nodes are.
+func fleetConsistency(t *target) error {
+	if t.fleet == nil {
+		return nil
+	}
+
+	proof, getErr := t.bodyOrGet("/system/proof")
+	if getErr != nil {
+		return getErr
+	}
+
+	f := t.fleet
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var reported []*fleetMember
+	for _, m := range f.members {
+		if m.target == t {
+			m.reported = true
+			m.stateVersion = gjson.GetBytes(proof, "header.version").Float()
+			m.epoch = gjson.GetBytes(proof, "header.epoch").Float()
+		}
+		if m.reported {
+			reported = append(reported, m)
+		}
+	}
+
+	minVersion, maxVersion := reported[0].stateVersion, reported[0].stateVersion
+	minEpoch, maxEpoch := reported[0].epoch, reported[0].epoch
+	for _, m := range reported {
+		if m.stateVersion < minVersion {
+			minVersion = m.stateVersion
+		}
+		if m.stateVersion > maxVersion {
+			maxVersion = m.stateVersion
+		}
+		if m.epoch < minEpoch {
+			minEpoch = m.epoch
+		}
+		if m.epoch > maxEpoch {
+			maxEpoch = m.epoch
+		}
+	}
+
+	f.stateVersionSpread.Set(maxVersion - minVersion)
+	f.epochSpread.Set(maxEpoch - minEpoch)
+	for _, m := range reported {
+		m.behindLeader.Set(maxVersion - m.stateVersion)
+	}
+	return nil
+}
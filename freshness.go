@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Consecutive failed collections after which a target's metrics are no
+// longer served
+var staleAfter int
+
+// freshGatherer gathers the registry, leaving out the metrics of targets
+// that failed -stale-after collections in a row. Serving their last values
+// forever would hide the outage, while missing series go stale in
+// Prometheus.
+type freshGatherer struct {
+	targets []*target
+}
+
+func (g freshGatherer) Gather() ([]*dto.MetricFamily, error) {
+	var stale []*target
+	for _, t := range g.targets {
+		if t.stale() {
+			stale = append(stale, t)
+		}
+	}
+	return withoutTargets{registry, stale}.Gather()
+}
+
+// withoutTargets leaves the metrics of targets out of those of gatherer,
+// except the exporter's own, including radix_exporter_up, and
+// radix_node_reachable, which tell why they are missing.
+type withoutTargets struct {
+	gatherer prometheus.Gatherer
+	targets  []*target
+}
+
+func (g withoutTargets) Gather() ([]*dto.MetricFamily, error) {
+	families, gatherErr := g.gatherer.Gather()
+	if len(g.targets) == 0 {
+		return families, gatherErr
+	}
+
+	var labelSets []prometheus.Labels
+	for _, t := range g.targets {
+		labelSets = append(labelSets, t.labels)
+	}
+
+	var kept []*dto.MetricFamily
+	for _, family := range families {
+		if strings.HasPrefix(family.GetName(), "radix_exporter_") || family.GetName() == "radix_node_reachable" {
+			kept = append(kept, family)
+			continue
+		}
+
+		var metrics []*dto.Metric
+		for _, m := range family.GetMetric() {
+			if !hasAnyLabels(m, labelSets) {
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) > 0 {
+			family.Metric = metrics
+			kept = append(kept, family)
+		}
+	}
+	return kept, gatherErr
+}
+
+// hasAnyLabels tells whether m carries all of any of labelSets. The empty
+// set of the single -b target matches every metric.
+func hasAnyLabels(m *dto.Metric, labelSets []prometheus.Labels) bool {
+	for _, labels := range labelSets {
+		matched := 0
+		for _, pair := range m.GetLabel() {
+			value, found := labels[pair.GetName()]
+			if found && value == pair.GetValue() {
+				matched++
+			}
+		}
+		if matched == len(labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordOutcome keeps count of the failed collections in a row.
+func (t *target) recordOutcome(err error) {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	if err != nil {
+		t.failuresInRow++
+		t.up.Set(0)
+	} else {
+		t.failuresInRow = 0
+		t.up.Set(1)
+	}
+}
+
+func (t *target) stale() bool {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	return staleAfter > 0 && t.failuresInRow >= staleAfter
+}
+
+// gatedCollector leaves out the metrics of Collector unless collector, the
+// one setting them, succeeded in the last collection cycle of t, so a failed
+// endpoint drops its series rather than leaving stale or zero values.
+type gatedCollector struct {
+	prometheus.Collector
+	t         *target
+	collector string
+}
+
+func (g gatedCollector) Collect(ch chan<- prometheus.Metric) {
+	if g.t.succeeded(g.collector) {
+		g.Collector.Collect(ch)
+	}
+}
+
+// registerFor registers cs like registerFrom, only exporting them while
+// collector succeeds.
+func (t *target) registerFor(collector, source string, cs ...prometheus.Collector) {
+	for _, c := range cs {
+		registerFrom(t.registerer, source, gatedCollector{c, t, collector})
+	}
+}
+
+// setSucceeded replaces the collectors that succeeded in the last cycle.
+// It is only called once a cycle is done, so scrapes in between keep
+// seeing the previous cycle's metrics.
+func (t *target) setSucceeded(succeeded map[string]bool) {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	t.succeededCollectors = succeeded
+}
+
+func (t *target) succeeded(collector string) bool {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	return t.succeededCollectors[collector]
+}
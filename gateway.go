@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+func (t *target) setGateway(gateway string) {
+	t.gateway = gateway
+
+	t.gatewayNetworkId = newGauge(prometheus.GaugeOpts{
+		Name: "radix_gateway_network_id",
+		Help: "Network id the gateway serves",
+	})
+	t.gatewayStateVersion = newGauge(prometheus.GaugeOpts{
+		Name: "radix_gateway_ledger_state_version",
+		Help: "Ledger state version of the gateway",
+	})
+	t.gatewayRoundTimestamp = newGauge(prometheus.GaugeOpts{
+		Name: "radix_gateway_round_timestamp_seconds",
+		Help: "Proposer timestamp of the gateway's latest round since unix epoch in seconds",
+	})
+	t.gatewayStateVersionBehind = newGauge(prometheus.GaugeOpts{
+		Name: "radix_gateway_ledger_state_version_behind",
+		Help: "Count of ledger state versions the node lags behind the gateway, negative when ahead",
+	})
+	t.gatewayUp = newGauge(prometheus.GaugeOpts{
+		Name: "radix_gateway_up",
+		Help: "Whether the gateway answered every query of the last collection",
+	})
+
+	t.registerFor("gateway", "gateway /status/network-configuration, /status/network-status",
+		t.gatewayNetworkId, t.gatewayStateVersion, t.gatewayRoundTimestamp, t.gatewayStateVersionBehind)
+	registerFrom(t.registerer, "gateway /status/network-configuration, /status/network-status", t.gatewayUp)
+}
+
+// gatewayFailed reports a failed gateway query. Collectors of the gateway
+// are optional, so this only fails their own metrics, as an outage of the
+// public gateway says nothing about the node, and must neither fail over
+// to a backup nor make the node's metrics go stale.
+func (t *target) gatewayFailed(err error) error {
+	t.gatewayUp.Set(0)
+	return fmt.Errorf("%s: %v", t.gateway, err)
+}
+
+// gatewayStatus compares the node's ledger with the public gateway's, a
+// direct measure of whether the node lags behind the network.
+func gatewayStatus(t *target) error {
+	if t.gateway == "" {
+		return nil
+	}
+
+	configuration, configErr := t.fetchFrom(t.gateway, "POST", "/status/network-configuration", []byte("{}"), nil)
+	if configErr != nil {
+		return t.gatewayFailed(configErr)
+	}
+	t.gatewayNetworkId.Set(gjson.GetBytes(configuration, "network_id").Float())
+
+	status, statusErr := t.fetchFrom(t.gateway, "POST", "/status/network-status", []byte("{}"), nil)
+	if statusErr != nil {
+		return t.gatewayFailed(statusErr)
+	}
+	t.gatewayUp.Set(1)
+
+	gatewayVersion := gjson.GetBytes(status, "ledger_state.state_version").Float()
+	t.gatewayStateVersion.Set(gatewayVersion)
+
+	roundTime, timeErr := time.Parse(time.RFC3339, gjson.GetBytes(status, "ledger_state.proposer_round_timestamp").String())
+	if timeErr == nil {
+		t.gatewayRoundTimestamp.Set(float64(roundTime.UnixNano()) / 1e9)
+	}
+
+	proof, getErr := t.bodyOrGet("/system/proof")
+	if getErr != nil {
+		return getErr
+	}
+	t.gatewayStateVersionBehind.Set(gatewayVersion - gjson.GetBytes(proof, "header.version").Float())
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/tidwall/gjson"
+)
+
+// Fields of /system/info that are not exported, as named in metrics
+var ignoredInfoKeys = map[string]bool{
+	"radix_info_system_version_system_version_agent_version":    true,
+	"radix_info_system_version_system_version_protocol_version": true,
+	"radix_agent_protocol":                          true,
+	"radix_agent_version":                           true,
+	"radix_info_configuration_pacemakerRate":        true,
+	"radix_info_configuration_pacemakerTimeout":     true,
+	"radix_info_configuration_pacemakerMaxExponent": true,
+}
+
+// walkNumbers calls emit for every number in the JSON document doc, named
+// by appending the keys and array indexes on the way to prefix with
+// underscores, as flatten.UnderscoreStyle did. The document is walked in
+// place and the name built in one buffer, which emit must not keep, so
+// looking up existing gauges by string(name) allocates nothing.
+func walkNumbers(doc gjson.Result, prefix string, emit func(name []byte, value float64)) {
+	name := make([]byte, 0, 128)
+	name = append(name, prefix...)
+
+	var walk func(value gjson.Result)
+	walk = func(value gjson.Result) {
+		switch {
+		case value.IsObject() || value.IsArray():
+			n := len(name)
+			i := 0
+			value.ForEach(func(key, nested gjson.Result) bool {
+				if n > len(prefix) {
+					name = append(name, '_')
+				}
+				if value.IsArray() {
+					name = strconv.AppendInt(name, int64(i), 10)
+				} else {
+					name = append(name, key.Str...)
+				}
+				walk(nested)
+				name = name[:n]
+				i++
+				return true
+			})
+		case value.Type == gjson.Number:
+			emit(name, value.Num)
+		}
+	}
+	walk(doc)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Address family to connect to nodes with, ipv4, ipv6 or any
+var ipProtocol = "any"
+
+// dialNetwork narrows network, e.g. tcp, to the -ip-protocol family.
+func dialNetwork(network string) string {
+	switch ipProtocol {
+	case "ipv4":
+		return network + "4"
+	case "ipv6":
+		return network + "6"
+	}
+	return network
+}
+
+func checkIPProtocol() error {
+	switch ipProtocol {
+	case "ipv4", "ipv6", "any":
+		return nil
+	}
+	return fmt.Errorf("-ip-protocol must be ipv4, ipv6 or any")
+}
+
+// newTransport is the default transport, except that with -ip-protocol it
+// only resolves and connects to addresses of that family. Hosts with both
+// otherwise get whichever answers first, and IPv6 only hosts fail whenever
+// an IPv4 address is tried.
+func newTransport() http.RoundTripper {
+	if ipProtocol == "any" {
+		return http.DefaultTransport
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, dialNetwork(network), addr)
+	}
+	return transport
+}
+
+// checkBaseUrl refuses base urls with an IPv6 address that is not in
+// brackets, like http://::1:3333, whose port cannot be told apart from the
+// address, and IP addresses of the family -ip-protocol excludes.
+func checkBaseUrl(baseUrl string) error {
+	host := baseUrl
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	host = strings.SplitN(host, "/", 2)[0]
+	host = host[strings.LastIndex(host, "@")+1:]
+	if strings.Count(host, ":") > 1 && !strings.HasPrefix(host, "[") {
+		return fmt.Errorf("%s: IPv6 addresses need brackets, e.g. http://[::1]:3333", baseUrl)
+	}
+
+	u, parseErr := url.Parse(baseUrl)
+	if parseErr != nil {
+		return parseErr
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%s: expected a url like http://host:port", baseUrl)
+	}
+
+	ip := net.ParseIP(strings.SplitN(u.Hostname(), "%", 2)[0])
+	if ip != nil {
+		isIPv4 := ip.To4() != nil
+		if (ipProtocol == "ipv4" && !isIPv4) || (ipProtocol == "ipv6" && isIPv4) {
+			return fmt.Errorf("%s: not an %s address, as -ip-protocol requires", baseUrl, ipProtocol)
+		}
+	}
+	return nil
+}
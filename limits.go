@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	maxMemory byteSize
+	scrapes   = &scrapeLimit{}
+
+	radix_exporter_shed_total = newCounterVec(prometheus.CounterOpts{
+		Name: "radix_exporter_shed_total",
+		Help: "Count of collections cut short or scrapes turned away to stay within resource limits",
+	}, []string{"reason"})
+)
+
+func init() {
+	registerFrom(registry, "exporter", radix_exporter_shed_total)
+
+	radix_exporter_shed_total.WithLabelValues("memory")
+	radix_exporter_shed_total.WithLabelValues("concurrency")
+}
+
+// overMemoryBudget tells whether the heap is above -max-memory. If so, a
+// garbage collection is run first in case that gets it back below.
+func overMemoryBudget() bool {
+	if maxMemory == 0 {
+		return false
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc <= uint64(maxMemory) {
+		return false
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc > uint64(maxMemory)
+}
+
+// scrapeLimit counts the scrapes in flight, up to max of them.
+type scrapeLimit struct {
+	mu       sync.Mutex
+	max      int
+	inFlight int
+}
+
+func (l *scrapeLimit) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max > 0 && l.inFlight >= l.max {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+func (l *scrapeLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+}
+
+// limitScrapes turns away scrapes of h beyond -max-concurrent-scrapes.
+func limitScrapes(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !scrapes.acquire() {
+			radix_exporter_shed_total.WithLabelValues("concurrency").Inc()
+			http.Error(w, "Too many concurrent scrapes", http.StatusServiceUnavailable)
+			return
+		}
+		defer scrapes.release()
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// byteSize is a flag taking sizes like 512KiB, 64MiB or 1GiB.
+type byteSize uint64
+
+var byteUnits = []struct {
+	suffix string
+	size   uint64
+}{
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+func (b *byteSize) String() string {
+	return strconv.FormatUint(uint64(*b), 10)
+}
+
+func (b *byteSize) Set(value string) error {
+	unit := uint64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value = strings.TrimSuffix(value, u.suffix)
+			unit = u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return fmt.Errorf("expected a size like 64MiB")
+	}
+	*b = byteSize(n * unit)
+	return nil
+}
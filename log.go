@@ -0,0 +1,13 @@
+package main
+
+import (
+	"log"
+)
+
+var logLevel string
+
+func debugf(format string, v ...interface{}) {
+	if logLevel == "debug" {
+		log.Printf("debug: "+format, v...)
+	}
+}
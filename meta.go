@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+// metaLabel lifts the string at path of an endpoint's response into a
+// label of radix_node_meta.
+type metaLabel struct {
+	Name     string `yaml:"name"`
+	Endpoint string `yaml:"endpoint"`
+	Path     string `yaml:"path"`
+}
+
+// setMetaLabels registers radix_node_meta with one label per meta label.
+func (t *target) setMetaLabels(labels []metaLabel) {
+	if len(labels) == 0 {
+		return
+	}
+
+	names := make([]string, len(labels))
+	for i, l := range labels {
+		names[i] = l.Name
+	}
+
+	t.metaLabels = labels
+	t.nodeMeta = newGaugeVec(prometheus.GaugeOpts{
+		Name: "radix_node_meta",
+		Help: "Always 1, with string fields of the node API as labels",
+	}, names)
+	t.registerFor("meta", "meta_labels", t.nodeMeta)
+}
+
+// nodeMeta sets radix_node_meta from the responses of this collection,
+// only fetching endpoints no other collector has. The labels are optional,
+// so a failed request keeps the last ones rather than failing the
+// collection.
+func nodeMeta(t *target) error {
+	if t.nodeMeta == nil {
+		return nil
+	}
+
+	values := make([]string, len(t.metaLabels))
+	for i, l := range t.metaLabels {
+		body, found := t.body(l.Endpoint)
+		if !found {
+			var fetchErr error
+			body, fetchErr = t.fetch(endpointMethod(l.Endpoint), l.Endpoint)
+			if fetchErr != nil {
+				t.warn("meta label %s: %v", l.Name, fetchErr)
+				return nil
+			}
+		}
+		values[i] = gjson.GetBytes(body, l.Path).String()
+	}
+
+	t.nodeMeta.Reset()
+	t.nodeMeta.WithLabelValues(values...).Set(1)
+	return nil
+}
+
+// endpointMethod is the method the node API answers at endpoint: POST for
+// /node and below, e.g. /node/validator, and GET for the rest.
+func endpointMethod(endpoint string) string {
+	if endpoint == "/node" || strings.HasPrefix(endpoint, "/node/") {
+		return "POST"
+	}
+	return "GET"
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+// networkDirections maps the /system/info counters of traffic to the
+// direction label.
+var networkDirections = []struct {
+	direction string
+	bytes     string
+	messages  string
+	opened    string
+}{
+	{"in", "info.counters.networking.received_bytes", "info.counters.messages.inbound", "info.counters.networking.tcp.in_opened"},
+	{"out", "info.counters.networking.sent_bytes", "info.counters.messages.outbound", "info.counters.networking.tcp.out_opened"},
+}
+
+// networkTraffic exports the gossip traffic counters of /system/info as
+// counters by direction, as radix_info_ has them as gauges, which rate()
+// must not be used on. Message counters are broken down by every number
+// the node has for them, except pending messages, which are not a count of
+// events and stay a radix_info_ gauge.
+func (t *target) networkTraffic(info gjson.Result) {
+	var metrics []Metric
+	for _, d := range networkDirections {
+		bytes := info.Get(d.bytes)
+		if bytes.Exists() {
+			metrics = append(metrics, Metric{
+				Name:   "radix_network_bytes_total",
+				Help:   "Bytes of gossip traffic since the node started",
+				Type:   prometheus.CounterValue,
+				Labels: map[string]string{"direction": d.direction},
+				Value:  bytes.Float(),
+			})
+		}
+
+		opened := info.Get(d.opened)
+		if opened.Exists() {
+			metrics = append(metrics, Metric{
+				Name:   "radix_network_tcp_connections_opened_total",
+				Help:   "Count of TCP connections to peers opened since the node started",
+				Type:   prometheus.CounterValue,
+				Labels: map[string]string{"direction": d.direction},
+				Value:  opened.Float(),
+			})
+		}
+
+		info.Get(d.messages).ForEach(func(key, count gjson.Result) bool {
+			if key.String() != "pending" && count.Type == gjson.Number {
+				metrics = append(metrics, Metric{
+					Name:   "radix_network_messages_total",
+					Help:   "Count of gossip messages since the node started, by what became of them",
+					Type:   prometheus.CounterValue,
+					Labels: map[string]string{"direction": d.direction, "outcome": key.String()},
+					Value:  count.Float(),
+				})
+			}
+			return true
+		})
+	}
+
+	dropped := info.Get("info.counters.networking.udp.dropped_messages")
+	if dropped.Exists() {
+		metrics = append(metrics, Metric{
+			Name:  "radix_network_udp_dropped_messages_total",
+			Help:  "Count of UDP messages dropped since the node started",
+			Type:  prometheus.CounterValue,
+			Value: dropped.Float(),
+		})
+	}
+
+	t.setPluginMetrics("info/network", "/system/info", metrics)
+}
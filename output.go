@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Refuse to overwrite textfiles written after the collection started
+var keepNewer bool
+
+// textfile is a file metrics get written to, and the targets whose metrics
+// it holds.
+type textfile struct {
+	path    string
+	targets []*target
+
+	// Stamp of the last write of this instance
+	written time.Time
+}
+
+// outputNames are what output path templates can refer to, e.g.
+// /var/lib/node_exporter/textfiles/radix_{{.NodeName}}.prom.
+type outputNames struct {
+	Network string
+	// The node name within its network, else the network name, else the
+	// host of -b
+	NodeName string
+}
+
+// textfiles decides where the metrics of targets get written. Without a
+// template, output is the directory of one radix_info.prom holding them
+// all, else the path of a file per target, or group of targets if the
+// template tells only networks apart.
+func textfiles(output string, targets []*target) ([]*textfile, error) {
+	if !strings.Contains(output, "{{") {
+		return []*textfile{{path: output + "/radix_info.prom", targets: targets}}, nil
+	}
+
+	tmpl, tmplErr := template.New("output").Option("missingkey=error").Parse(output)
+	if tmplErr != nil {
+		return nil, tmplErr
+	}
+
+	var files []*textfile
+	byPath := map[string]*textfile{}
+	for _, t := range targets {
+		var path bytes.Buffer
+		execErr := tmpl.Execute(&path, t.outputNames())
+		if execErr != nil {
+			return nil, execErr
+		}
+
+		f, found := byPath[path.String()]
+		if !found {
+			f = &textfile{path: path.String()}
+			byPath[f.path] = f
+			files = append(files, f)
+		}
+		f.targets = append(f.targets, t)
+	}
+	return files, nil
+}
+
+func (t *target) outputNames() outputNames {
+	parts := strings.SplitN(t.name, "/", 2)
+	names := outputNames{Network: parts[0], NodeName: parts[len(parts)-1]}
+	if names.NodeName == "" {
+		u, parseErr := url.Parse(t.baseUrl)
+		if parseErr == nil {
+			names.NodeName = u.Hostname()
+		}
+	}
+	return names
+}
+
+func (f *textfile) holds(t *target) bool {
+	for _, held := range f.targets {
+		if held == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *textfile) holdsAny(targets []*target) bool {
+	for _, t := range targets {
+		if f.holds(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// write writes the metrics of f's targets that gatherer has, from a
+// collection started at collected. Metrics not labelled for a single
+// target, e.g. those of the exporter or of a fleet, go to the file of the
+// first target they could belong to, so no two files repeat a series.
+func (f *textfile) write(gatherer prometheus.Gatherer, all []*target, collected time.Time) error {
+	now := time.Now()
+	if keepNewer {
+		written := writtenTime(f.path)
+		if written.After(collected) && !written.Equal(f.written) {
+			return fmt.Errorf("not overwriting %s, it was written at %s after this collection started, by another instance or a host with its clock ahead", f.path, written.Format(time.RFC3339))
+		}
+	}
+
+	if len(f.targets) < len(all) {
+		gatherer = ownedGatherer{gatherer, f, all}
+	}
+
+	writtenRegistry := prometheus.NewRegistry()
+	written := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "radix_info_written_timestamp_seconds",
+		Help: "Time this file was written at since unix epoch in seconds, to tell how stale it is",
+	})
+	writtenRegistry.MustRegister(written)
+	stamp := float64(now.UnixNano()) / 1e9
+	written.Set(stamp)
+
+	writeErr := prometheus.WriteToTextfile(f.path, prometheus.Gatherers{gatherer, writtenRegistry})
+	if writeErr == nil {
+		f.written = stampTime(stamp)
+	}
+	return writeErr
+}
+
+func stampTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*1e9))
+}
+
+// writtenTime reads radix_info_written_timestamp_seconds of the textfile at
+// path, if there is one.
+func writtenTime(path string) time.Time {
+	data, readErr := ioutil.ReadFile(path)
+	if readErr != nil {
+		return time.Time{}
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "radix_info_written_timestamp_seconds" {
+			seconds, parseErr := strconv.ParseFloat(fields[1], 64)
+			if parseErr == nil {
+				return stampTime(seconds)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+type ownedGatherer struct {
+	gatherer prometheus.Gatherer
+	file     *textfile
+	all      []*target
+}
+
+func (g ownedGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, gatherErr := g.gatherer.Gather()
+
+	owned := map[*target]bool{}
+	for _, t := range g.file.targets {
+		owned[t] = true
+	}
+
+	var kept []*dto.MetricFamily
+	for _, family := range families {
+		var metrics []*dto.Metric
+		for _, m := range family.GetMetric() {
+			if owned[owner(m, g.all)] {
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) > 0 {
+			family.Metric = metrics
+			kept = append(kept, family)
+		}
+	}
+	return kept, gatherErr
+}
+
+// owner is the first of targets whose labels m does not contradict. Empty
+// labels do not, as fleet metrics have those of nodes left empty.
+func owner(m *dto.Metric, targets []*target) *target {
+	for _, t := range targets {
+		contradicts := false
+		for _, pair := range m.GetLabel() {
+			value, found := t.labels[pair.GetName()]
+			if found && pair.GetValue() != "" && value != pair.GetValue() {
+				contradicts = true
+				break
+			}
+		}
+		if !contradicts {
+			return t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+// recordPeers counts the peers that came and went since the last
+// collection. Peers present when a network is first seen start the baseline
+// rather than counting as connected, and their session age starts then too.
+func (t *target) recordPeers(peers map[string]bool) {
+	now := float64(clock().Unix())
+	url := t.currentUrl()
+
+	t.updateState(func(s *targetState) {
+		// A backup node has peers of its own, so failing over starts over
+		baseline := s.Peers == nil || (s.PeersUrl != "" && s.PeersUrl != url)
+		if baseline {
+			s.Peers = map[string]float64{}
+		}
+		s.PeersUrl = url
+
+		for key := range s.Peers {
+			if !peers[key] {
+				delete(s.Peers, key)
+				s.PeersDisconnected++
+			}
+		}
+		for key := range peers {
+			if _, found := s.Peers[key]; !found {
+				s.Peers[key] = now
+				if !baseline {
+					s.PeersConnected++
+				}
+			}
+		}
+	})
+}
+
+// peerSessionAge is the average time the current peers have been connected
+// for, in seconds.
+func (t *target) peerSessionAge() float64 {
+	now := float64(clock().UnixNano()) / 1e9
+
+	return t.readState(func(s *targetState) float64 {
+		if len(s.Peers) == 0 {
+			return 0
+		}
+		var total float64
+		for _, since := range s.Peers {
+			total += now - since
+		}
+		return total / float64(len(s.Peers))
+	})
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is what forks implement to add metrics of their own, e.g. from
+// an internal staking service, without changing the core files. They are
+// registered from an init function in a file of their own:
+//
+//	func init() {
+//		RegisterCollector(stakingService{})
+//	}
+//
+// Collect may use the target's getDataContext and postDataContext to query
+// its node, which give up once ctx is done, at the latest after the node
+// request timeout.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context, t *target) ([]Metric, error)
+}
+
+// Metric is a value reported by a Collector. The target's labels are added
+// to Labels, and Type defaults to a gauge.
+type Metric struct {
+	Name   string
+	Help   string
+	Type   prometheus.ValueType
+	Labels map[string]string
+	Value  float64
+}
+
+// RegisterCollector adds c after the built-in collectors. Like the optional
+// ones, it can be disabled by --no-collector.<name> and is skipped while over
+// the -max-memory budget. Its metrics are replaced on every collection.
+func RegisterCollector(c Collector) {
+	collectors = append(collectors, &collector{
+		name: c.Name(),
+		collect: func(t *target) error {
+			ctx, cancel := context.WithTimeout(context.Background(), t.client.Timeout)
+			defer cancel()
+
+			metrics, collectErr := c.Collect(ctx, t)
+			if collectErr != nil {
+				return collectErr
+			}
+			t.setPluginMetrics(c.Name(), c.Name(), metrics)
+			return nil
+		},
+		enabled:  true,
+		optional: true,
+	})
+}
+
+// setPluginMetrics replaces the metrics of a collector. Metrics that would
+// fail every scrape are dropped with a warning: invalid ones, ones with a
+// label the exporter sets itself, and ones another metric of the target
+// already has, or with other label names, type or help than it. Names of
+// built-in metrics are not checked, so collectors need a prefix of their
+// own. The kept metrics are added to the catalog as coming from source.
+func (t *target) setPluginMetrics(collector, source string, metrics []Metric) {
+	t.cycleMu.Lock()
+
+	delete(t.pluginMetrics, collector)
+	first := map[string]Metric{}
+	series := map[string]bool{}
+	for _, others := range t.pluginMetrics {
+		for _, m := range others {
+			if _, found := first[m.Name]; !found {
+				first[m.Name] = m
+			}
+			series[seriesKey(m)] = true
+		}
+	}
+
+	var kept []Metric
+	var problems []string
+	for _, m := range metrics {
+		problem := t.pluginMetricProblem(m, first, series)
+		if problem != "" {
+			problems = append(problems, m.Name+": "+problem)
+			continue
+		}
+		if _, found := first[m.Name]; !found {
+			first[m.Name] = m
+		}
+		series[seriesKey(m)] = true
+		kept = append(kept, m)
+	}
+	t.pluginMetrics[collector] = kept
+	t.cycleMu.Unlock()
+
+	for _, problem := range problems {
+		t.warn("%s: dropped %s", collector, problem)
+	}
+	for _, m := range kept {
+		names, _ := sortedLabels(m.Labels)
+		addToCatalog(catalogEntry{Name: m.Name, Type: valueTypeName(m.Type), Help: m.Help, Labels: names, Source: source}, registererLabels(t.registerer))
+	}
+}
+
+func valueTypeName(valueType prometheus.ValueType) string {
+	switch valueType {
+	case prometheus.CounterValue:
+		return "counter"
+	case prometheus.UntypedValue:
+		return "untyped"
+	}
+	return "gauge"
+}
+
+func (t *target) pluginMetricProblem(m Metric, first map[string]Metric, series map[string]bool) string {
+	for name := range m.Labels {
+		_, byTarget := t.labels[name]
+		if byTarget || name == "network" || name == "node" {
+			return "the " + name + " label is set by the exporter"
+		}
+	}
+
+	names, values := sortedLabels(m.Labels)
+	_, metricErr := prometheus.NewConstMetric(prometheus.NewDesc(m.Name, m.Help, names, nil), prometheus.GaugeValue, m.Value, values...)
+	if metricErr != nil {
+		return metricErr.Error()
+	}
+
+	if series[seriesKey(m)] {
+		return "duplicate series"
+	}
+	if f, found := first[m.Name]; found {
+		firstNames, _ := sortedLabels(f.Labels)
+		if strings.Join(firstNames, ",") != strings.Join(names, ",") || f.Type != m.Type || f.Help != m.Help {
+			return "other label names, type or help than another metric of that name"
+		}
+	}
+	return ""
+}
+
+func sortedLabels(labels map[string]string) ([]string, []string) {
+	var names, values []string
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values = append(values, labels[name])
+	}
+	return names, values
+}
+
+// seriesKey tells the series of m apart.
+func seriesKey(m Metric) string {
+	names, values := sortedLabels(m.Labels)
+	key := m.Name
+	for i := range names {
+		key += "\x00" + names[i] + "=" + values[i]
+	}
+	return key
+}
+
+// pluginCollector exports the last metrics of every Collector for a target,
+// of those that succeeded in the last cycle. Which metrics they report is
+// not known up front, so it describes none.
+type pluginCollector struct {
+	t *target
+}
+
+func (p pluginCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (p pluginCollector) Collect(ch chan<- prometheus.Metric) {
+	p.t.cycleMu.Lock()
+	defer p.t.cycleMu.Unlock()
+
+	for key, metrics := range p.t.pluginMetrics {
+		collector := strings.SplitN(key, "/", 2)[0]
+		if !p.t.succeededCollectors[collector] {
+			continue
+		}
+		for _, m := range metrics {
+			names, values := sortedLabels(m.Labels)
+
+			valueType := m.Type
+			if valueType == 0 {
+				valueType = prometheus.GaugeValue
+			}
+
+			metric, metricErr := prometheus.NewConstMetric(prometheus.NewDesc(m.Name, m.Help, names, nil), valueType, m.Value, values...)
+			if metricErr != nil {
+				metric = prometheus.NewInvalidMetric(prometheus.NewDesc(m.Name, m.Help, nil, nil), metricErr)
+			}
+			ch <- metric
+		}
+	}
+}
@@ -1,186 +1,642 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/jeremywohl/flatten"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/tidwall/gjson"
 )
 
 var (
 	registry = prometheus.NewRegistry()
 
-	radix_validator_peers_count = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "radix_validator_peers_count",
-		Help: "Count of Validator Peers",
-	})
+	collectors = []*collector{
+		{name: "info", collect: systemInfo, enabled: true},
+		{name: "peers", collect: systemPeers, enabled: true},
+		{name: "epochproof", collect: systemEpochproof, enabled: true},
+		{name: "validator", collect: nodeValidator, enabled: true},
+		{name: "connectivity", collect: peerConnectivity, enabled: true, optional: true},
+		{name: "meta", collect: nodeMeta, enabled: true, optional: true},
+		{name: "gateway", collect: gatewayStatus, enabled: true, optional: true},
+		{name: "slo", collect: proposalSLO, enabled: true, optional: true},
+		{name: "fleet", collect: fleetConsistency, enabled: true, optional: true},
+		{name: "exec", collect: execCommands, enabled: true, optional: true},
+	}
+)
 
-	radix_validator_next_validators_count = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "radix_validator_next_validators_count",
-	})
+type collector struct {
+	name    string
+	collect func(t *target) error
+	enabled bool
 
-	radix_validator_next_validators_stake_min = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "radix_validator_next_validators_stake_min",
-	})
+	// Optional collectors are skipped while over the -max-memory budget,
+	// and their failures neither fail a collection nor fail it over
+	optional bool
+}
 
-	radix_validator_next_validators_stake_max = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "radix_validator_next_validators_stake_max",
-	})
+// noCollectorFlag disables a collector, like node_exporter's
+// --no-collector.<name>.
+type noCollectorFlag struct {
+	c *collector
+}
 
-	radix_validator_stake_total = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "radix_validator_stake_total",
-	})
+func (f noCollectorFlag) String() string {
+	if f.c == nil {
+		return "false"
+	}
+	return strconv.FormatBool(!f.c.enabled)
+}
 
-	radix_validator_delegators_count = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "radix_validator_delegators_count",
-	})
-)
+func (f noCollectorFlag) Set(value string) error {
+	disabled, parseErr := strconv.ParseBool(value)
+	if parseErr != nil {
+		return parseErr
+	}
+	f.c.enabled = !disabled
+	return nil
+}
 
-func init() {
-	registry.MustRegister(radix_validator_peers_count)
-	registry.MustRegister(radix_validator_next_validators_count)
-	registry.MustRegister(radix_validator_next_validators_stake_min)
-	registry.MustRegister(radix_validator_next_validators_stake_max)
-	registry.MustRegister(radix_validator_stake_total)
-	registry.MustRegister(radix_validator_delegators_count)
+func (f noCollectorFlag) IsBoolFlag() bool {
+	return true
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "convert" {
+		os.Exit(convertCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		os.Exit(compareCommand(os.Args[2:]))
+	}
+
 	var baseUrl string
+	var configFile string
+	var interval time.Duration
+	var epochAligned bool
+	var epochPoll time.Duration
+	var listen string
+	var telemetryPath string
+	headers := headerFlag{}
+	var cookies bool
+	var sshDest, sshKey, sshKnownHosts string
+	var gateway string
+	var fallbacks string
+	var summaryJson bool
+	var softFail bool
 
 	flag.StringVar(&baseUrl, "b", "http://localhost:3333", "Specify base url. Default is http://localhost:3333")
+	flag.StringVar(&configFile, "config", "", "YAML file configuring networks to collect from and meta labels")
+	flag.Var(headers, "header", "Header to send with every request, as \"Name: value\". Can be repeated")
+	flag.BoolVar(&cookies, "cookies", false, "Keep cookies between requests, for targets behind Cloudflare Access or SSO proxies")
+	flag.StringVar(&fallbacks, "fallback", "", "Comma separated base urls to collect from when -b fails, e.g. a backup node")
+	flag.StringVar(&sshDest, "ssh", "", "Connect to the node API and the gateway through SSH to user@host[:port], e.g. when the node API only listens on localhost there. Their urls are resolved on the SSH server")
+	flag.StringVar(&sshKey, "ssh-key", "", "Private key file to authenticate with -ssh")
+	flag.StringVar(&sshKnownHosts, "ssh-known-hosts", os.ExpandEnv("$HOME/.ssh/known_hosts"), "known_hosts file to verify the -ssh host key with")
+	flag.StringVar(&ipProtocol, "ip-protocol", ipProtocol, "Address family to connect to nodes and gateways with, ipv4, ipv6 or any. With -ssh, of the SSH connection, while the SSH server resolves the node")
+	flag.StringVar(&gateway, "gateway", "", "Gateway API base url to compare the node's ledger with, e.g. https://mainnet.radixdlt.com")
+	flag.DurationVar(&interval, "interval", 0, "Collect repeatedly at this interval. Default is a single collection")
+	flag.BoolVar(&epochAligned, "epoch-aligned", false, "Also collect right after each epoch transition. Requires -interval")
+	flag.DurationVar(&epochPoll, "epoch-poll", 10*time.Second, "How often to poll the epoch number in -epoch-aligned mode")
+	flag.BoolVar(&sourceTimestamps, "source-timestamps", false, "Write metrics measured at a known time, e.g. of the last epoch proof, with that timestamp to the textfile. node_exporter refuses these")
+	flag.BoolVar(&keepNewer, "keep-newer", false, "Refuse to overwrite a textfile written after the collection started, going by its radix_info_written_timestamp_seconds, e.g. by a competing cron job or a host with its clock ahead")
+	flag.BoolVar(&softFail, "soft-fail", false, "When a single collection finds nodes unreachable, still write the textfile with radix_node_reachable 0 and the exporter's metrics for them, and exit 0, rather than leaving the last textfile in place")
+	flag.BoolVar(&summaryJson, "summary-json", false, "Print a JSON summary of a single collection to stdout")
+	flag.StringVar(&listen, "listen", "", "Address to serve HTTP endpoints on, e.g. :9100. Default is no HTTP server")
+	flag.StringVar(&listen, "web.listen-address", "", "Alias of -listen")
+	flag.StringVar(&telemetryPath, "web.telemetry-path", "/metrics", "Path under which to expose metrics on the -listen address")
+	flag.IntVar(&staleAfter, "stale-after", 3, "Failed collections in a row after which a network's metrics are no longer served over HTTP, except radix_exporter_ ones. 0 keeps serving the last values")
+	flag.StringVar(&debugToken, "debug-token", "", "Bearer token enabling /debug/responses/<endpoint> on the -listen address")
+	flag.StringVar(&stateFile, "state", "", "JSON file to keep state in between runs, e.g. stake history and collection counts. Default is memory only")
+	flag.StringVar(&restartCounter, "restart-counter", "info.counters.messages.inbound.received", "Path of a /system/info counter that only resets when the node restarts")
+	flag.IntVar(&stakeWindow, "stake-window", 12, "Count of epochs to average the minimum stake to enter the validator set over")
+	flag.Var(&maxMemory, "max-memory", "Heap size above which optional collectors are skipped, e.g. 64MiB. Default is no limit")
+	flag.IntVar(&scrapes.max, "max-concurrent-scrapes", 0, "Count of scrapes served at once, further ones get a 503. Default is no limit")
+	flag.BoolVar(&logRedact, "log.redact", true, "Redact credentials, tokens and delegator addresses from logs. Disable for local debugging only")
+	flag.StringVar(&logLevel, "log.level", "info", "Log level, info or debug. Debug logs timings of every request")
+	flag.IntVar(&responses.size, "debug-responses", 5, "Count of raw responses to keep per endpoint for /debug/responses")
+	for _, c := range collectors {
+		flag.BoolVar(&c.enabled, "collector."+c.name, c.enabled, "Enable the "+c.name+" collector")
+		flag.Var(noCollectorFlag{c}, "no-collector."+c.name, "Disable the "+c.name+" collector")
+	}
 
 	flag.Usage = func() {
 		fmt.Printf("Usage: \n")
-		fmt.Printf("./main -b baseUrl outputPath \n")
+		fmt.Printf("./main -b baseUrl [-interval 1m [-epoch-aligned]] outputPath \n")
+		fmt.Printf("./main -b baseUrl --web.listen-address :9100 [--web.telemetry-path /metrics] \n")
+		fmt.Printf("./main -config networks.yml [-listen :9100] [outputPath] \n")
+		fmt.Printf("./main -config networks.yml '/var/lib/node_exporter/textfiles/radix_{{.Network}}_{{.NodeName}}.prom' \n")
+		fmt.Printf("./main -ssh user@validator -ssh-key ~/.ssh/id_ed25519 -b http://localhost:3333 outputPath \n")
+		fmt.Printf("./main config print|check [flags] \n")
+		fmt.Printf("./main convert file.prom --to json|csv \n")
+		fmt.Printf("./main compare --addresses a,b,c [--gateway url] [--json] \n")
+		fmt.Printf("\nFlags: \n")
+		flag.PrintDefaults()
 	}
 
-	flag.Parse()
+	// Subcommands come first, followed by the flags they apply to
+	args := os.Args[1:]
+	var command []string
+	if len(args) > 0 && args[0] == "config" {
+		if len(args) < 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		command, args = args[:2], args[2:]
+	}
+	flag.CommandLine.Parse(args)
+
+	ipErr := checkIPProtocol()
+	if ipErr != nil {
+		fmt.Fprintln(os.Stderr, ipErr)
+		os.Exit(2)
+	}
+
+	log.SetOutput(redactingWriter{os.Stderr})
+	addSecret(debugToken)
+	for _, value := range headers {
+		addSecret(value)
+	}
+
+	if command != nil {
+		defaults := networkConfig{Url: baseUrl, Interval: interval, Headers: headers, Cookies: cookies, Gateway: gateway}
+		if fallbacks != "" {
+			defaults.Fallbacks = strings.Split(fallbacks, ",")
+		}
+		os.Exit(configCommand(command[1], configFile, defaults))
+	}
 
 	path := flag.Arg(0)
 	if path == "" {
 		path = "."
 	}
 
-	systemInfo(baseUrl)
-	systemPeers(baseUrl)
-	systemEpochproof(baseUrl)
-	nodeValidator(baseUrl)
+	// When serving metrics over HTTP, only write the textfile if asked to
+	writeTextfile := listen == "" || flag.NArg() > 0
+
+	loadErr := loadState()
+	if loadErr != nil {
+		log.Fatal(loadErr)
+	}
+
+	var targets []*target
+	if configFile != "" {
+		cfg, cfgErr := loadConfig(configFile)
+		if cfgErr != nil {
+			log.Fatal(cfgErr)
+		}
+		targets = cfg.targets(baseUrl, interval)
+	} else {
+		targets = []*target{newTarget("", baseUrl, interval, registry)}
+	}
+	if fallbacks != "" && targets[0].name == "" {
+		targets[0].fallbacks = strings.Split(fallbacks, ",")
+	}
+	flagUrls := networkConfig{Gateway: gateway}
+	if targets[0].name == "" {
+		flagUrls.Url, flagUrls.Fallbacks = baseUrl, targets[0].fallbacks
+	}
+	urlErr := flagUrls.checkUrls()
+	if urlErr != nil {
+		log.Fatal(urlErr)
+	}
+
+	var tunnel *sshTunnel
+	if sshDest != "" {
+		var sshErr error
+		tunnel, sshErr = newSSHTunnel(sshDest, sshKey, sshKnownHosts)
+		if sshErr != nil {
+			log.Fatal(sshErr)
+		}
+	}
+
+	for _, t := range targets {
+		if tunnel != nil {
+			t.useTunnel(tunnel)
+		}
+		if len(t.headers) == 0 {
+			t.headers = headers
+		}
+		if cookies {
+			t.keepCookies()
+		}
+		if t.gateway == "" && gateway != "" {
+			t.setGateway(gateway)
+		}
+	}
+
+	files, filesErr := textfiles(path, targets)
+	if filesErr != nil {
+		log.Fatal(filesErr)
+	}
+	var outputs []string
+	for _, f := range files {
+		outputs = append(outputs, f.path)
+	}
+
+	var textfileGatherer prometheus.Gatherer = registry
+	if sourceTimestamps {
+		textfileGatherer = timestampedGatherer{targets}
+	}
+
+	looping := targets[0].interval > 0
+	for _, t := range targets {
+		if (t.interval > 0) != looping {
+			log.Fatal("Either all networks or none must have a collection interval")
+		}
+	}
+	if epochAligned && !looping {
+		log.Fatal("-epoch-aligned requires -interval")
+	}
+	if targets[0].slo != nil && !looping && listen == "" && stateFile == "" {
+		log.Fatal("slo without -interval or -listen requires -state, to keep the proposal history between runs")
+	}
 
-	prometheus.WriteToTextfile(path+"/radix_info.prom", registry)
+	if !looping {
+		if listen != "" {
+			// Collect on every scrape, like conventional exporters do
+			serveMux.Handle(telemetryPath, scrapeHandler(targets))
+			log.Fatal(http.ListenAndServe(listen, serveMux))
+		}
+
+		start := time.Now()
+
+		// Nodes that answered may have failed just some collectors, whose
+		// metrics are left out, so they are still written down but fail the
+		// run. Unreachable ones are only left out with -soft-fail, else the
+		// last files holding them are left in place. Every target is
+		// collected either way, so the files of the others are written.
+		failed := false
+		var unreachable []*target
+		for _, t := range targets {
+			err := runCollection(t)
+			if err == nil {
+				continue
+			}
+			log.Print(err)
+			if t.reachable() {
+				failed = true
+			} else {
+				unreachable = append(unreachable, t)
+				failed = failed || !softFail
+			}
+		}
+
+		gatherer := withoutTargets{textfileGatherer, unreachable}
+		for _, f := range files {
+			if !softFail && f.holdsAny(unreachable) {
+				continue
+			}
+			writeErr := f.write(gatherer, targets, start)
+			if writeErr != nil {
+				log.Print(writeErr)
+				failed = true
+			}
+		}
+
+		if summaryJson {
+			printSummary(targets, strings.Join(outputs, ","), !failed, time.Since(start))
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if listen != "" {
+		serveMux.Handle(telemetryPath, limitScrapes(promhttp.HandlerFor(freshGatherer{targets}, promhttp.HandlerOpts{})))
+		go func() {
+			log.Fatal(http.ListenAndServe(listen, serveMux))
+		}()
+	}
+
+	// Networks collect independently, but may share a textfile
+	var writeMu sync.Mutex
+	for _, t := range targets {
+		go func(t *target) {
+			var epochChanges <-chan int64
+			if epochAligned {
+				epochChanges = watchEpoch(t, epochPoll)
+			}
+
+			ticker := time.NewTicker(t.interval)
+			for {
+				start := time.Now()
+				err := runCollection(t)
+				if err != nil {
+					log.Print(err)
+				}
+				if writeTextfile {
+					writeMu.Lock()
+					for _, f := range files {
+						if f.holds(t) {
+							writeErr := f.write(textfileGatherer, targets, start)
+							if writeErr != nil {
+								log.Print(writeErr)
+							}
+						}
+					}
+					writeMu.Unlock()
+				}
+
+				select {
+				case <-ticker.C:
+				case epoch := <-epochChanges:
+					log.Printf("%sEpoch changed to %d, collecting now", t.logPrefix(), epoch)
+				}
+			}
+		}(t)
+	}
+	select {}
+}
+
+func collect(t *target) error {
+	t.resetCycle()
+	defer t.logTraces()
+
+	shed := overMemoryBudget()
+	if shed {
+		t.warn("Over the -max-memory budget, skipping optional collectors")
+		radix_exporter_shed_total.WithLabelValues("memory").Inc()
+	}
+
+	// A failing endpoint only fails its collector, the others still run.
+	// Only failures of the core collectors fail the collection, and so
+	// fail over to a backup node API; optional ones are warned about.
+	var failures []string
+	succeeded := map[string]bool{}
+	for _, c := range collectors {
+		if !c.enabled {
+			continue
+		}
+
+		if !shed || !c.optional {
+			err := c.collect(t)
+			t.finishTraces()
+			if err == nil {
+				succeeded[c.name] = true
+			} else if c.optional {
+				t.warn("%s: %v", c.name, err)
+			} else {
+				failures = append(failures, err.Error())
+			}
+		}
+		if succeeded[c.name] {
+			t.collectorSuccess.WithLabelValues(c.name).Set(1)
+		} else {
+			t.collectorSuccess.WithLabelValues(c.name).Set(0)
+		}
+	}
+	t.setSucceeded(succeeded)
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// scrapeHandler runs a collection before serving the registry. Concurrent
+// scrapes wait for each other rather than hitting the node in parallel,
+// and beyond -max-concurrent-scrapes they are turned away.
+func scrapeHandler(targets []*target) http.Handler {
+	var mu sync.Mutex
+	handler := promhttp.HandlerFor(freshGatherer{targets}, promhttp.HandlerOpts{})
+
+	return limitScrapes(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, t := range targets {
+			err := runCollection(t)
+			if err != nil {
+				log.Print(err)
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
 }
 
 func newClient() *http.Client {
 	c := &http.Client{
-		Timeout: 10 * time.Second,
+		Transport:     newTransport(),
+		Timeout:       10 * time.Second,
+		CheckRedirect: sameHostRedirect,
 	}
 	return c
 }
 
-func systemInfo(baseUrl string) {
-	url := baseUrl + "/system/info"
-	body := getData(url)
-
-	var info map[string]interface{}
-	jsonErr := json.Unmarshal(body, &info)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
+func systemInfo(t *target) error {
+	body, getErr := t.getData("/system/info")
+	if getErr != nil {
+		return getErr
 	}
 
-	flat, flatErr := flatten.Flatten(info, "radix_", flatten.UnderscoreStyle)
-	if flatErr != nil {
-		log.Fatal(flatErr)
+	info := gjson.ParseBytes(body)
+	if !gjson.ValidBytes(body) || !info.IsObject() {
+		return fmt.Errorf("GET /system/info: expected a JSON object")
 	}
+	t.parsed("/system/info")
 
-	// Remove unwanted keys
-	delete(flat, "radix_info_system_version_system_version_agent_version")
-	delete(flat, "radix_info_system_version_system_version_protocol_version")
-	delete(flat, "radix_agent_protocol")
-	delete(flat, "radix_agent_version")
-	delete(flat, "radix_info_configuration_pacemakerRate")
-	delete(flat, "radix_info_configuration_pacemakerTimeout")
-	delete(flat, "radix_info_configuration_pacemakerMaxExponent")
+	t.checkRestart(info.Get(restartCounter))
 
 	// Dynamically create Gauges
-	for key, val := range flat {
-		v, ok := val.(float64)
-		if ok {
-			g := prometheus.NewGauge(prometheus.GaugeOpts{Name: key})
-			registry.MustRegister(g)
-			g.Set(v)
+	walkNumbers(info, "radix_", func(name []byte, v float64) {
+		if ignoredInfoKeys[string(name)] {
+			return
 		}
-	}
+		g, found := t.infoGauges[string(name)]
+		if !found {
+			key := string(name)
+			g = newGauge(prometheus.GaugeOpts{Name: key})
+			t.registerFor("info", "/system/info", g)
+			t.infoGauges[key] = g
+		}
+		g.Set(v)
+	})
+	t.networkTraffic(info)
+	t.consensusDepth(info)
+	return nil
 }
 
-func systemPeers(baseUrl string) {
-	url := baseUrl + "/system/peers"
-	body := getData(url)
+func systemPeers(t *target) error {
+	body, getErr := t.getData("/system/peers")
+	if getErr != nil {
+		return getErr
+	}
 
-	var peers []interface{}
-	jsonErr := json.Unmarshal(body, &peers)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
+	// Iterate the peers in place rather than decoding hundreds of them
+	peers := gjson.ParseBytes(body)
+	if !gjson.ValidBytes(body) || !peers.IsArray() {
+		return fmt.Errorf("GET /system/peers: expected a JSON array")
 	}
+	t.peers = map[string]bool{}
+	count := 0
+	peers.ForEach(func(_, peer gjson.Result) bool {
+		t.peers[nodeKey(peer.Get("address").String())] = true
+		count++
+		return true
+	})
+	t.parsed("/system/peers")
+	t.recordPeers(t.peers)
 
-	radix_validator_peers_count.Set(float64(len(peers)))
+	t.peersCount.Set(float64(count))
+	return nil
 }
 
-func systemEpochproof(baseUrl string) {
-	url := baseUrl + "/system/epochproof"
-	body := getData(url)
+func systemEpochproof(t *target) error {
+	body, getErr := t.getData("/system/epochproof")
+	if getErr != nil {
+		return getErr
+	}
+
+	t.validatorStakes = map[string]float64{}
+	gjson.GetBytes(body, "header.nextValidators").ForEach(func(_, validator gjson.Result) bool {
+		t.validatorStakes[nodeKey(validator.Get("address").String())] = validator.Get("stake").Float()
+		return true
+	})
 
 	result := gjson.GetBytes(body, "header.nextValidators.#.stake")
 
 	nextValidators := result.Array()
+	t.parsed("/system/epochproof")
 	if len(nextValidators) > 0 {
 		minStake, maxStake := minMax(nextValidators)
 
-		radix_validator_next_validators_count.Set(float64(len(nextValidators)))
-		radix_validator_next_validators_stake_min.Set((minStake / 1e18))
-		radix_validator_next_validators_stake_max.Set((maxStake / 1e18))
+		t.nextValidatorsCount.Set(float64(len(nextValidators)))
+		t.nextValidatorsStakeMin.Set((minStake / 1e18))
+		t.nextValidatorsStakeMax.Set((maxStake / 1e18))
+
+		t.recordMinStake(gjson.GetBytes(body, "header.epoch").Int(), minStake/1e18)
 	}
+
+	t.recordEpoch(gjson.GetBytes(body, "header.epoch").Int(), gjson.GetBytes(body, "header.timestamp").Float())
+	return nil
 }
 
-func nodeValidator(baseUrl string) {
-	url := baseUrl + "/node/validator"
-	body := postData(url)
+func nodeValidator(t *target) error {
+	body, postErr := t.postData("/node/validator")
+	if postErr != nil {
+		return postErr
+	}
+
+	t.validatorAddress = gjson.GetBytes(body, "validator.address").String()
 
 	totalStakes := gjson.GetBytes(body, "validator.totalStake").Float()
 	stakes := gjson.GetBytes(body, "validator.stakes").Array()
+	t.parsed("/node/validator")
 
-	radix_validator_stake_total.Set(totalStakes)
-	radix_validator_delegators_count.Set(float64(len(stakes)))
-}
+	t.stakeTotal.Set(totalStakes)
+	t.delegatorsCount.Set(float64(len(stakes)))
 
-func getData(url string) []byte {
-	r, getErr := newClient().Get(url)
-	if getErr != nil {
-		log.Fatal(getErr)
+	// The owner stakes like any other delegator, from the owner's account
+	owner := gjson.GetBytes(body, "validator.owner").String()
+	var ownerStake float64
+	for _, stake := range stakes {
+		if owner != "" && stake.Get("delegator").String() == owner {
+			ownerStake += stake.Get("amount").Float()
+		}
+	}
+	t.stakeOwner.Set(ownerStake)
+	t.stakeExternal.Set(totalStakes - ownerStake)
+	if totalStakes > 0 {
+		t.stakeOwnerRatio.Set(ownerStake / totalStakes)
+	} else {
+		t.stakeOwnerRatio.Set(0)
 	}
 
-	if r.Body != nil {
-		defer r.Body.Close()
+	if t.delegatorStake != nil {
+		t.delegatorStake.Reset()
+		for _, stake := range stakes {
+			label := t.delegators.label(stake.Get("delegator").String())
+			t.delegatorStake.WithLabelValues(label).Add(stake.Get("amount").Float() / 1e18)
+		}
 	}
+	return nil
+}
 
-	body, readErr := ioutil.ReadAll(r.Body)
-	if readErr != nil {
-		log.Fatal(readErr)
+func (t *target) getData(endpoint string) ([]byte, error) {
+	return t.fetch("GET", endpoint)
+}
+
+func (t *target) postData(endpoint string) ([]byte, error) {
+	return t.fetch("POST", endpoint)
+}
+
+// getDataContext is getData, giving up once ctx is done.
+func (t *target) getDataContext(ctx context.Context, endpoint string) ([]byte, error) {
+	return t.fetchContext(ctx, t.currentUrl(), "GET", endpoint, nil, t.headers)
+}
+
+// postDataContext is postData, giving up once ctx is done.
+func (t *target) postDataContext(ctx context.Context, endpoint string) ([]byte, error) {
+	return t.fetchContext(ctx, t.currentUrl(), "POST", endpoint, nil, t.headers)
+}
+
+func (t *target) fetch(method, endpoint string) ([]byte, error) {
+	return t.fetchFrom(t.currentUrl(), method, endpoint, nil, t.headers)
+}
+
+// fetchFrom requests endpoint of an API at baseUrl, which is the node API
+// unless a collector talks to another service on behalf of the target.
+func (t *target) fetchFrom(baseUrl, method, endpoint string, payload []byte, headers map[string]string) ([]byte, error) {
+	return t.fetchContext(context.Background(), baseUrl, method, endpoint, payload, headers)
+}
+
+func (t *target) fetchContext(ctx context.Context, baseUrl, method, endpoint string, payload []byte, headers map[string]string) ([]byte, error) {
+	body, sendErr := t.send(ctx, baseUrl, method, endpoint, payload, headers, t.startTrace(baseUrl, endpoint))
+	if sendErr != nil {
+		return nil, sendErr
 	}
 
-	return body
+	t.keepBody(endpoint, body)
+	return body, nil
 }
 
-func postData(url string) []byte {
-	r, postErr := newClient().Post(url, "application/json", nil)
-	if postErr != nil {
-		log.Fatal(postErr)
+// pollData gets endpoint of the node outside of collections, e.g. to watch
+// for epoch changes while one runs. It is left out of the collection's
+// traces and bodies.
+func (t *target) pollData(endpoint string) ([]byte, error) {
+	trace := &endpointTrace{endpoint: endpoint, start: time.Now()}
+	return t.send(context.Background(), t.currentUrl(), "GET", endpoint, nil, t.headers, trace)
+}
+
+// send makes a request, recording its progress in trace.
+func (t *target) send(ctx context.Context, baseUrl, method, endpoint string, payload []byte, headers map[string]string, trace *endpointTrace) ([]byte, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, reqErr := http.NewRequestWithContext(ctx, method, baseUrl+endpoint, reqBody)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	if method == "POST" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+
+	r, doErr := t.client.Do(req)
+	if doErr != nil {
+		trace.err = doErr
+		return nil, doErr
 	}
 
 	if r.Body != nil {
@@ -189,10 +645,23 @@ func postData(url string) []byte {
 
 	body, readErr := ioutil.ReadAll(r.Body)
 	if readErr != nil {
-		log.Fatal(readErr)
+		trace.err = readErr
+		return nil, readErr
 	}
+	trace.readDone = time.Now()
+	trace.status = r.StatusCode
+
+	responses.record(t.name, r, body)
 
-	return body
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		trace.err = statusError(method, endpoint, r, body)
+		return nil, trace.err
+	}
+	if !looksLikeJson(body) {
+		trace.err = fmt.Errorf("%s %s: expected JSON, got %s", method, endpoint, snippet(r, body))
+		return nil, trace.err
+	}
+	return body, nil
 }
 
 func minMax(array []gjson.Result) (float64, float64) {
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Characters of account addresses kept in logs past their common prefix
+const addressChars = 6
+
+var (
+	logRedact bool
+
+	// Configured secrets such as header values, redacted wherever they show
+	// as a whole, rather than as part of a longer word
+	secretsMu sync.Mutex
+	secrets   []*regexp.Regexp
+
+	redactions = []struct {
+		re   *regexp.Regexp
+		with string
+	}{
+		// Userinfo of URLs, which net/http errors embed in full
+		{regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/@\s"]+@`), "${1}REDACTED@"},
+		{regexp.MustCompile(`(?i)(bearer\s+)[^\s"]+`), "${1}REDACTED"},
+	}
+
+	// Account addresses, e.g. of delegators, which keep enough to tell them
+	// apart
+	accountAddress = regexp.MustCompile(`\b[a-z]dx[0-9]*1[02-9ac-hj-np-z]+`)
+)
+
+// addSecret makes secret get redacted from logs and error messages.
+func addSecret(secret string) {
+	if secret == "" {
+		return
+	}
+
+	// Characters of tokens, which a secret must not run into. Separators of
+	// query strings, cookies, paths and headers such as = / & ; : are not.
+	const word = `a-zA-Z0-9_.~+-`
+	re := regexp.MustCompile(`(^|[^` + word + `])` + regexp.QuoteMeta(secret) + `($|[^` + word + `])`)
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	secrets = append(secrets, re)
+}
+
+// redact removes credentials, tokens and full account addresses from s,
+// unless -log.redact=false.
+func redact(s string) string {
+	if !logRedact {
+		return s
+	}
+	return maskSecrets(s)
+}
+
+// maskSecrets redacts s regardless of -log.redact.
+func maskSecrets(s string) string {
+	secretsMu.Lock()
+	for _, secret := range secrets {
+		// A match takes the separator after the secret, so a second pass
+		// gets occurrences separated by a single character
+		s = secret.ReplaceAllString(s, "${1}REDACTED${2}")
+		s = secret.ReplaceAllString(s, "${1}REDACTED${2}")
+	}
+	secretsMu.Unlock()
+
+	return maskPatterns(s)
+}
+
+// maskPatterns redacts what looks like credentials and account addresses
+// from s, but not configured secrets.
+func maskPatterns(s string) string {
+	for _, r := range redactions {
+		s = r.re.ReplaceAllString(s, r.with)
+	}
+	return accountAddress.ReplaceAllStringFunc(s, shortenAddress)
+}
+
+// shortenAddress keeps addressChars characters of address past what all
+// account addresses of its network start with.
+func shortenAddress(address string) string {
+	keep := accountPrefixLength(address)
+	if keep == 0 {
+		keep = strings.LastIndex(address, "1") + 1
+	}
+	keep += addressChars
+
+	if len(address) <= keep {
+		return address
+	}
+	return address[:keep] + "..."
+}
+
+// redactingWriter is the output of the log package, so nothing gets
+// logged without being redacted.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (rw redactingWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(rw.w, redact(string(p)))
+	return len(p), err
+}
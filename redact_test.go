@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMaskSecrets(t *testing.T) {
+	addSecret("s3cr3t")
+	addSecret("dG9rZW4=")
+
+	cases := []struct {
+		in       string
+		expected string
+	}{
+		{"s3cr3t", "REDACTED"},
+		{"GET http://h/?token=s3cr3t&x=1", "GET http://h/?token=REDACTED&x=1"},
+		{"GET http://h/?token=s3cr3t", "GET http://h/?token=REDACTED"},
+		{"Cookie: session=s3cr3t; theme=dark", "Cookie: session=REDACTED; theme=dark"},
+		{"GET http://h/s3cr3t/x", "GET http://h/REDACTED/x"},
+		{"X-Api-Key:s3cr3t", "X-Api-Key:REDACTED"},
+		{"Authorization: Basic dG9rZW4=", "Authorization: Basic REDACTED"},
+		{"s3cr3t,s3cr3t,s3cr3t", "REDACTED,REDACTED,REDACTED"},
+		{"xs3cr3t s3cr3t-2", "xs3cr3t s3cr3t-2"},
+	}
+	for _, c := range cases {
+		got := maskSecrets(c.in)
+		if got != c.expected {
+			t.Errorf("maskSecrets(%q) = %q, expected %q", c.in, got, c.expected)
+		}
+	}
+}
+
+func TestShortenAddresses(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected string
+	}{
+		{"stake of rdx1qspxwq3c4cqlr0n4n8yp7t76jm2acn7xv4l3dgkzdaj8n0yv4g6s2ts6dnkqq", "stake of rdx1qspxwq3c4..."},
+		{"stake of rdx1qsp8n0yv4g6s2ts6dnkqqxwq3c4cqlr0n4n8yp7t76jm2acn7xv4l3dgkzdaj", "stake of rdx1qsp8n0yv4..."},
+		{"tdx21qspxwq3c4cqlr0n4n8yp7t76jm2acn7xv4l3dgkzdaj8n0yv4g6s2ts6dnkqq", "tdx21qspxwq3c4..."},
+		{"rdx1qsps", "rdx1qsps"},
+		{"rdx1alice", "rdx1alice"},
+	}
+	for _, c := range cases {
+		got := maskPatterns(c.in)
+		if got != c.expected {
+			t.Errorf("maskPatterns(%q) = %q, expected %q", c.in, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/tidwall/gjson"
+)
+
+var restartCounter string
+
+// checkRestart counts a node restart whenever the -restart-counter value
+// went down since the last collection. The node's start time can only be
+// told to within a collection interval, so the time the restart was seen
+// stands in for it. A failover to or from a backup node is no restart.
+func (t *target) checkRestart(counter gjson.Result) {
+	if !counter.Exists() {
+		return
+	}
+
+	value := counter.Float()
+	now := float64(clock().Unix())
+	url := t.currentUrl()
+
+	t.updateState(func(s *targetState) {
+		switched := s.RestartUrl != "" && s.RestartUrl != url
+		s.RestartUrl = url
+		if value < s.RestartCounter && !switched {
+			s.Restarts++
+			s.NodeStartTime = now
+		}
+		if s.NodeStartTime == 0 {
+			s.NodeStartTime = now
+		}
+		s.RestartCounter = value
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+// Proposals are sampled this often at most, to keep the history small
+const proposalSampleInterval = 5 * time.Minute
+
+// sloConfig is an uptime objective for the validator, e.g. 99.5% of its
+// proposals completed over 30 days. The validator's proposal counts are
+// read from an Olympia Gateway API, which knows it by the rv1... address
+// the node reports, unlike the Babylon gateway of -gateway. They are
+// sampled into the -state file, so the history only covers the time the
+// exporter has been collecting:
+//
+//	slo:
+//	  gateway: https://olympia-gateway.example.com
+//	  proposals: 99.5
+//	  window: 720h
+//	  burn_windows: [1h, 6h, 24h, 72h]
+type sloConfig struct {
+	Gateway     string          `yaml:"gateway"`
+	Proposals   float64         `yaml:"proposals"`
+	Window      time.Duration   `yaml:"window"`
+	BurnWindows []time.Duration `yaml:"burn_windows"`
+}
+
+// proposalCount is a sample of the proposal counts of the gateway, which
+// covers the epochs from From on.
+type proposalCount struct {
+	Time   float64 `json:"time"`
+	From   float64 `json:"from"`
+	Made   float64 `json:"made"`
+	Missed float64 `json:"missed"`
+}
+
+func (slo *sloConfig) validate() error {
+	if slo.Gateway == "" {
+		return fmt.Errorf("slo needs the gateway url of an Olympia Gateway API")
+	}
+	urlErr := checkBaseUrl(slo.Gateway)
+	if urlErr != nil {
+		return urlErr
+	}
+	if slo.Proposals <= 0 || slo.Proposals >= 100 {
+		return fmt.Errorf("slo proposals must be a percentage between 0 and 100")
+	}
+	if slo.Window == 0 {
+		slo.Window = 30 * 24 * time.Hour
+	}
+	if len(slo.BurnWindows) == 0 {
+		slo.BurnWindows = []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour, 72 * time.Hour}
+	}
+	for _, w := range slo.BurnWindows {
+		if w < proposalSampleInterval || w > slo.Window {
+			return fmt.Errorf("slo burn windows must be between %v and the window", proposalSampleInterval)
+		}
+	}
+	return nil
+}
+
+func (t *target) setSLO(slo *sloConfig) {
+	t.slo = slo
+
+	t.sloBudgetRemaining = newGauge(prometheus.GaugeOpts{
+		Name: "radix_validator_slo_error_budget_remaining_ratio",
+		Help: "Share of the proposals the validator may miss over the SLO window that are left, negative once overspent",
+	})
+	t.sloBurnRate = newGaugeVec(prometheus.GaugeOpts{
+		Name: "radix_validator_slo_burn_rate",
+		Help: "Rate proposals were missed at over the window, relative to the rate that exactly uses up the error budget",
+	}, []string{"window"})
+
+	t.registerFor("slo", "slo gateway /validator", t.sloBudgetRemaining, t.sloBurnRate)
+}
+
+// proposalSLO samples the proposals the validator completed and missed
+// from the Olympia gateway, which counts them over a range of epochs, and
+// rates the misses within each window from the history.
+func proposalSLO(t *target) error {
+	if t.slo == nil {
+		return nil
+	}
+	if t.validatorAddress == "" {
+		return fmt.Errorf("no validator address, as /node/validator failed")
+	}
+
+	gateway, gatewayErr := t.fetchFrom(t.slo.Gateway, "POST", "/gateway", []byte("{}"), nil)
+	if gatewayErr != nil {
+		return fmt.Errorf("%s: %v", t.slo.Gateway, gatewayErr)
+	}
+	network := gjson.GetBytes(gateway, "network_identifier.network").String()
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"network_identifier":   map[string]string{"network": network},
+		"validator_identifier": map[string]string{"address": t.validatorAddress},
+	})
+	body, validatorErr := t.fetchFrom(t.slo.Gateway, "POST", "/validator", payload, nil)
+	if validatorErr != nil {
+		return fmt.Errorf("%s: %v", t.slo.Gateway, validatorErr)
+	}
+	uptime := gjson.GetBytes(body, "validator.info.uptime")
+	if !uptime.Exists() {
+		return fmt.Errorf("%s: POST /validator: no uptime of validator %s", t.slo.Gateway, t.validatorAddress)
+	}
+
+	now := proposalCount{
+		Time:   float64(clock().Unix()),
+		From:   uptime.Get("epoch_range.from").Float(),
+		Made:   uptime.Get("proposals_completed").Float(),
+		Missed: uptime.Get("proposals_missed").Float(),
+	}
+	history := t.recordProposals(now)
+
+	allowed := 1 - t.slo.Proposals/100
+	t.sloBudgetRemaining.Set(1 - missRatio(history, now, t.slo.Window)/allowed)
+	for _, w := range t.slo.BurnWindows {
+		t.sloBurnRate.WithLabelValues(formatWindow(w)).Set(missRatio(history, now, w) / allowed)
+	}
+	return nil
+}
+
+// recordProposals adds now to the history, keeping a sample per
+// proposalSampleInterval, and returns it. One sample before the SLO window
+// is kept to measure the whole window from. Counts over another range of
+// epochs, or gone down, can't be compared, so the history starts over.
+func (t *target) recordProposals(now proposalCount) []proposalCount {
+	var history []proposalCount
+	t.updateState(func(s *targetState) {
+		last := len(s.Proposals) - 1
+		if last >= 0 && (s.Proposals[last].From != now.From || now.Made < s.Proposals[last].Made || now.Missed < s.Proposals[last].Missed) {
+			s.Proposals = nil
+			last = -1
+		}
+		if last >= 1 && now.Time-s.Proposals[last-1].Time < proposalSampleInterval.Seconds() {
+			s.Proposals[last] = now
+		} else {
+			s.Proposals = append(s.Proposals, now)
+		}
+
+		start := now.Time - t.slo.Window.Seconds()
+		for len(s.Proposals) > 1 && s.Proposals[1].Time <= start {
+			s.Proposals = s.Proposals[1:]
+		}
+		history = append(history, s.Proposals...)
+	})
+	return history
+}
+
+// missRatio is the share of proposals missed between the last sample at
+// least window old, or else the oldest, and now.
+func missRatio(history []proposalCount, now proposalCount, window time.Duration) float64 {
+	from := history[0]
+	for _, h := range history {
+		if h.Time > now.Time-window.Seconds() {
+			break
+		}
+		from = h
+	}
+
+	made, missed := now.Made-from.Made, now.Missed-from.Missed
+	if made+missed <= 0 {
+		return 0
+	}
+	return missed / (made + missed)
+}
+
+func formatWindow(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return d.String()
+}
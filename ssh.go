@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshTunnel connects to node APIs through an SSH server, e.g. the validator
+// itself when its API only listens on localhost. Node urls are then resolved
+// on the SSH server, so http://localhost:3333 is the API next to it.
+type sshTunnel struct {
+	addr   string
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// newSSHTunnel parses dest as [user@]host[:port]. The host key must be in
+// knownHostsFile, as it would have to be for ssh itself.
+func newSSHTunnel(dest, keyFile, knownHostsFile string) (*sshTunnel, error) {
+	user := os.Getenv("USER")
+	host := dest
+	if at := strings.LastIndex(dest, "@"); at >= 0 {
+		user, host = dest[:at], dest[at+1:]
+	}
+	if _, _, splitErr := net.SplitHostPort(host); splitErr != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "22")
+	}
+
+	if keyFile == "" {
+		return nil, fmt.Errorf("-ssh needs -ssh-key")
+	}
+	key, readErr := ioutil.ReadFile(keyFile)
+	if readErr != nil {
+		return nil, readErr
+	}
+	signer, keyErr := ssh.ParsePrivateKey(key)
+	if keyErr != nil {
+		return nil, fmt.Errorf("%s: %v, keys with a passphrase are not supported", keyFile, keyErr)
+	}
+
+	hostKeys, hostsErr := knownhosts.New(knownHostsFile)
+	if hostsErr != nil {
+		return nil, hostsErr
+	}
+
+	return &sshTunnel{
+		addr: host,
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeys,
+			Timeout:         10 * time.Second,
+		},
+	}, nil
+}
+
+// dial opens a connection from the SSH server to addr. The SSH connection is
+// shared by all requests and redialed once it broke, so restarting the SSH
+// server does not need the exporter restarted. Only connecting to the SSH
+// server holds up other requests; connections through it are opened in
+// parallel, and given up with ctx.
+func (s *sshTunnel) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	for {
+		client, reused, connectErr := s.connect()
+		if connectErr != nil {
+			return nil, connectErr
+		}
+
+		conn, tunnelErr := client.DialContext(ctx, network, addr)
+		if tunnelErr == nil || !reused || ctx.Err() != nil {
+			return conn, tunnelErr
+		}
+		debugf("ssh %s: %v, reconnecting", s.addr, tunnelErr)
+		s.drop(client)
+	}
+}
+
+// connect returns the SSH connection, connecting first if there is none.
+func (s *sshTunnel) connect() (*ssh.Client, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != nil {
+		return s.client, true, nil
+	}
+	client, dialErr := ssh.Dial(dialNetwork("tcp"), s.addr, s.config)
+	if dialErr != nil {
+		return nil, false, fmt.Errorf("ssh %s: %v", s.addr, dialErr)
+	}
+	s.client = client
+	return client, false, nil
+}
+
+// drop closes a broken SSH connection, unless another request already
+// replaced it.
+func (s *sshTunnel) drop(client *ssh.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client.Close()
+	if s.client == client {
+		s.client = nil
+	}
+}
+
+// useTunnel makes t connect to its node, and its gateway, through s.
+func (t *target) useTunnel(s *sshTunnel) {
+	t.useTransport(&http.Transport{
+		DialContext:     s.dial,
+		IdleConnTimeout: 90 * time.Second,
+	})
+}
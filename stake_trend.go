@@ -0,0 +1,35 @@
+package main
+
+var stakeWindow int
+
+// recordMinStake adds the minimum stake of an epoch's validator set to the
+// history, and exports its moving average and growth over -stake-window
+// epochs. Prospective validators can forecast from them what stake it
+// takes to stay in the set.
+func (t *target) recordMinStake(epoch int64, stake float64) {
+	var history []epochStake
+	t.updateState(func(s *targetState) {
+		last := len(s.MinStakes) - 1
+		if last >= 0 && s.MinStakes[last].Epoch == epoch {
+			s.MinStakes[last].Stake = stake
+		} else {
+			s.MinStakes = append(s.MinStakes, epochStake{Epoch: epoch, Stake: stake})
+		}
+
+		if stakeWindow > 0 && len(s.MinStakes) > stakeWindow {
+			s.MinStakes = s.MinStakes[len(s.MinStakes)-stakeWindow:]
+		}
+		history = append(history, s.MinStakes...)
+	})
+
+	var sum float64
+	for _, h := range history {
+		sum += h.Stake
+	}
+	t.nextValidatorsStakeMinAvg.Set(sum / float64(len(history)))
+
+	first, last := history[0], history[len(history)-1]
+	if last.Epoch > first.Epoch {
+		t.nextValidatorsStakeMinGrowth.Set((last.Stake - first.Stake) / float64(last.Epoch-first.Epoch))
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	stateFile string
+
+	// What state is recorded at the time of, fixed in tests
+	clock = time.Now
+
+	// Per network state, "" being the node given by -b
+	stateMu sync.Mutex
+	states  = map[string]*targetState{}
+)
+
+// targetState is what the exporter remembers about a network between
+// runs, so one-shot runs can still export values spanning several epochs.
+type targetState struct {
+	MinStakes []epochStake `json:"min_stakes,omitempty"`
+
+	// RestartUrl is the node API the counter was last read from, as backup
+	// nodes have counters of their own
+	RestartCounter float64 `json:"restart_counter"`
+	RestartUrl     string  `json:"restart_url,omitempty"`
+	Restarts       float64 `json:"restarts"`
+	NodeStartTime  float64 `json:"node_start_time"`
+
+	Epoch           int64   `json:"epoch"`
+	EpochChangeTime float64 `json:"epoch_change_time"`
+
+	// Peers by nodeKey, with the time they were first seen on the node API
+	// of PeersUrl
+	Peers             map[string]float64 `json:"peers"`
+	PeersUrl          string             `json:"peers_url,omitempty"`
+	PeersConnected    float64            `json:"peers_connected"`
+	PeersDisconnected float64            `json:"peers_disconnected"`
+
+	Proposals []proposalCount `json:"proposals,omitempty"`
+
+	// Collections by result, and what they allocated
+	Collections              map[string]float64 `json:"collections,omitempty"`
+	CollectionAllocatedBytes float64            `json:"collection_allocated_bytes"`
+	CollectionAllocations    float64            `json:"collection_allocations"`
+}
+
+type epochStake struct {
+	Epoch int64   `json:"epoch"`
+	Stake float64 `json:"stake"`
+}
+
+func loadState() error {
+	if stateFile == "" {
+		return nil
+	}
+
+	data, readErr := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(readErr) {
+		return nil
+	}
+	if readErr != nil {
+		return readErr
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	return json.Unmarshal(data, &states)
+}
+
+// saveState writes the state of all networks, through a temporary file so
+// a crash never leaves a truncated one behind.
+func saveState() error {
+	if stateFile == "" {
+		return nil
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	data, jsonErr := json.MarshalIndent(states, "", "  ")
+	if jsonErr != nil {
+		return jsonErr
+	}
+
+	tmp := stateFile + ".tmp"
+	writeErr := ioutil.WriteFile(tmp, data, 0600)
+	if writeErr != nil {
+		return writeErr
+	}
+	return os.Rename(tmp, stateFile)
+}
+
+func stateOf(name string) *targetState {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	s, found := states[name]
+	if !found {
+		s = &targetState{}
+		states[name] = s
+	}
+	return s
+}
+
+// readState returns read applied to the state of t.
+func (t *target) readState(read func(s *targetState) float64) float64 {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	return read(t.state)
+}
+
+// updateState runs update on the state of t while no one else reads or
+// writes any state.
+func (t *target) updateState(update func(s *targetState)) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	update(t.state)
+}
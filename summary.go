@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// summary is what -summary-json prints after a single collection, for
+// config management tools verifying the exporter after a deployment.
+type summary struct {
+	Output          string          `json:"output"`
+	Written         bool            `json:"written"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	MetricFamilies  int             `json:"metric_families"`
+	Samples         int             `json:"samples"`
+	Targets         []targetSummary `json:"targets"`
+}
+
+type targetSummary struct {
+	Name      string            `json:"name"`
+	Url       string            `json:"url"`
+	Source    string            `json:"source"`
+	Endpoints []endpointSummary `json:"endpoints"`
+	Warnings  []string          `json:"warnings"`
+}
+
+type endpointSummary struct {
+	Endpoint        string  `json:"endpoint"`
+	Status          int     `json:"status"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+func printSummary(targets []*target, output string, written bool, duration time.Duration) {
+	s := summary{
+		Output:          output,
+		Written:         written,
+		DurationSeconds: duration.Seconds(),
+		Targets:         []targetSummary{},
+	}
+
+	families, gatherErr := registry.Gather()
+	if gatherErr != nil {
+		log.Print(gatherErr)
+	}
+	s.MetricFamilies = len(families)
+	for _, family := range families {
+		s.Samples += len(family.GetMetric())
+	}
+
+	for _, t := range targets {
+		s.Targets = append(s.Targets, t.summary())
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(s)
+}
+
+func (t *target) summary() targetSummary {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	s := targetSummary{
+		Name:      t.name,
+		Url:       redact(t.activeUrl),
+		Source:    t.lastSource,
+		Endpoints: []endpointSummary{},
+		Warnings:  []string{},
+	}
+	for _, warning := range t.warnings {
+		s.Warnings = append(s.Warnings, redact(warning))
+	}
+
+	for _, trace := range t.traces {
+		e := endpointSummary{
+			Endpoint: trace.endpoint,
+			Status:   trace.status,
+		}
+		if trace.err != nil {
+			e.Error = redact(trace.err.Error())
+		}
+
+		end := trace.registerDone
+		if end.IsZero() {
+			end = trace.readDone
+		}
+		e.DurationSeconds = between(trace.start, end).Seconds()
+
+		s.Endpoints = append(s.Endpoints, e)
+	}
+	return s
+}
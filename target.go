@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// target is one node API the exporter collects from, together with the
+// metrics collected from it.
+type target struct {
+	name       string
+	baseUrl    string
+	fallbacks  []string
+	interval   time.Duration
+	registerer prometheus.Registerer
+	labels     prometheus.Labels
+	client     *http.Client
+	headers    map[string]string
+
+	peersCount             prometheus.Gauge
+	nextValidatorsCount    prometheus.Gauge
+	nextValidatorsStakeMin prometheus.Gauge
+	nextValidatorsStakeMax prometheus.Gauge
+	stakeTotal             prometheus.Gauge
+	delegatorsCount        prometheus.Gauge
+
+	stakeOwner      prometheus.Gauge
+	stakeExternal   prometheus.Gauge
+	stakeOwnerRatio prometheus.Gauge
+
+	nextValidatorsStakeMinAvg    prometheus.Gauge
+	nextValidatorsStakeMinGrowth prometheus.Gauge
+
+	peersValidatorsConnected prometheus.Gauge
+	peersValidatorStakeRatio prometheus.Gauge
+
+	collectionDuration prometheus.Histogram
+	backupActive       prometheus.Gauge
+	up                 prometheus.Gauge
+	collectorSuccess   *prometheus.GaugeVec
+	nodeReachable      prometheus.Gauge
+
+	// Gauges created from /system/info, kept so repeated collections reuse them
+	infoGauges map[string]prometheus.Gauge
+
+	// Remembered between runs when -state is set
+	state *targetState
+
+	// Per-delegator stake, only exported when configured
+	delegators     delegatorExport
+	delegatorStake *prometheus.GaugeVec
+
+	// Public gateway to compare the node with, only collected when configured
+	gateway                   string
+	gatewayNetworkId          prometheus.Gauge
+	gatewayStateVersion       prometheus.Gauge
+	gatewayRoundTimestamp     prometheus.Gauge
+	gatewayStateVersionBehind prometheus.Gauge
+	gatewayUp                 prometheus.Gauge
+
+	// Uptime objective of the validator, only collected when configured
+	slo                *sloConfig
+	sloBudgetRemaining prometheus.Gauge
+	sloBurnRate        *prometheus.GaugeVec
+
+	// Other nodes of the same network, if several are configured
+	fleet *fleet
+
+	// Meta labels lifted from string fields into radix_node_meta
+	metaLabels []metaLabel
+	nodeMeta   *prometheus.GaugeVec
+
+	// Metrics of Collectors registered by forks, by collector name, of exec
+	// commands, by "exec/" and the command name, and of /system/info counters
+	// exported under names of their own, by "info/" and what they are about.
+	// Those before any "/" are only exported while that collector succeeds
+	pluginMetrics map[string][]Metric
+	execCommands  []execCommand
+
+	// Results of the last collection, for collectors combining endpoints
+	cycleMu             sync.Mutex
+	activeUrl           string
+	lastSource          string
+	succeededCollectors map[string]bool
+	warnings            []string
+	bodies              map[string][]byte
+	traces              []*endpointTrace
+	failuresInRow       int
+	peers               map[string]bool
+	validatorStakes     map[string]float64
+	validatorAddress    string
+}
+
+// newTarget creates the metrics of a target and registers them with
+// registerer, which is expected to add any labels identifying the target.
+func newTarget(name, baseUrl string, interval time.Duration, registerer prometheus.Registerer) *target {
+	t := &target{
+		name:       name,
+		baseUrl:    baseUrl,
+		interval:   interval,
+		registerer: registerer,
+		client:     newClient(),
+
+		peersCount: newGauge(prometheus.GaugeOpts{
+			Name: "radix_validator_peers_count",
+			Help: "Count of Validator Peers",
+		}),
+		nextValidatorsCount: newGauge(prometheus.GaugeOpts{
+			Name: "radix_validator_next_validators_count",
+		}),
+		nextValidatorsStakeMin: newGauge(prometheus.GaugeOpts{
+			Name: "radix_validator_next_validators_stake_min",
+		}),
+		nextValidatorsStakeMax: newGauge(prometheus.GaugeOpts{
+			Name: "radix_validator_next_validators_stake_max",
+		}),
+		stakeTotal: newGauge(prometheus.GaugeOpts{
+			Name: "radix_validator_stake_total",
+		}),
+		delegatorsCount: newGauge(prometheus.GaugeOpts{
+			Name: "radix_validator_delegators_count",
+		}),
+
+		stakeOwner: newGauge(prometheus.GaugeOpts{
+			Name: "radix_validator_stake_owner",
+			Help: "Part of radix_validator_stake_total staked by the validator's owner",
+		}),
+		stakeExternal: newGauge(prometheus.GaugeOpts{
+			Name: "radix_validator_stake_external",
+			Help: "Part of radix_validator_stake_total delegated by others than the validator's owner",
+		}),
+		stakeOwnerRatio: newGauge(prometheus.GaugeOpts{
+			Name: "radix_validator_stake_owner_ratio",
+			Help: "Share of the validator's stake staked by its owner",
+		}),
+
+		nextValidatorsStakeMinAvg: newGauge(prometheus.GaugeOpts{
+			Name: "radix_validator_next_validators_stake_min_avg",
+			Help: "Moving average of the minimum stake in the validator set over the last -stake-window epochs",
+		}),
+		nextValidatorsStakeMinGrowth: newGauge(prometheus.GaugeOpts{
+			Name: "radix_validator_next_validators_stake_min_growth_per_epoch",
+			Help: "Average change per epoch of the minimum stake in the validator set over the last -stake-window epochs",
+		}),
+
+		peersValidatorsConnected: newGauge(prometheus.GaugeOpts{
+			Name: "radix_peers_validators_connected_count",
+			Help: "Count of validators in the active set that are direct peers",
+		}),
+		peersValidatorStakeRatio: newGauge(prometheus.GaugeOpts{
+			Name: "radix_peers_validator_stake_connected_ratio",
+			Help: "Share of the active validator set's stake held by direct peers",
+		}),
+
+		collectionDuration: newHistogram(prometheus.HistogramOpts{
+			Name:    "radix_exporter_collection_duration_seconds",
+			Help:    "Duration of full collection cycles since the exporter started, so only of use with -interval or -listen",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}),
+		up: newGauge(prometheus.GaugeOpts{
+			Name: "radix_exporter_up",
+			Help: "Whether the last collection cycle succeeded",
+		}),
+		nodeReachable: newGauge(prometheus.GaugeOpts{
+			Name: "radix_node_reachable",
+			Help: "Whether the node API answered the last collection at all, even if with errors",
+		}),
+		backupActive: newGauge(prometheus.GaugeOpts{
+			Name: "radix_exporter_backup_active",
+			Help: "1 if the last collection was served by a backup node API",
+		}),
+		collectorSuccess: newGaugeVec(prometheus.GaugeOpts{
+			Name: "radix_exporter_collector_success",
+			Help: "Whether the collector succeeded in the last collection cycle. The metrics of one that did not are left out",
+		}, []string{"collector"}),
+
+		activeUrl:  baseUrl,
+		infoGauges: map[string]prometheus.Gauge{},
+		bodies:     map[string][]byte{},
+		state:      stateOf(name),
+
+		pluginMetrics: map[string][]Metric{},
+	}
+
+	t.registerFor("peers", "/system/peers", t.peersCount)
+	t.registerFor("epochproof", "/system/epochproof",
+		t.nextValidatorsCount, t.nextValidatorsStakeMin, t.nextValidatorsStakeMax, t.nextValidatorsStakeMinAvg, t.nextValidatorsStakeMinGrowth)
+	t.registerFor("validator", "/node/validator",
+		t.stakeTotal, t.delegatorsCount, t.stakeOwner, t.stakeExternal, t.stakeOwnerRatio)
+	t.registerFor("connectivity", "/system/peers, /system/epochproof", t.peersValidatorsConnected, t.peersValidatorStakeRatio)
+	registerFrom(registerer, "/system/info", newCounterFunc(prometheus.CounterOpts{
+		Name: "radix_node_restarts_total",
+		Help: "Count of node restarts seen, from -restart-counter resetting",
+	}, func() float64 {
+		return t.readState(func(s *targetState) float64 { return s.Restarts })
+	}))
+	registerFrom(registerer, "/system/info", newGaugeFunc(prometheus.GaugeOpts{
+		Name: "radix_node_start_time_seconds",
+		Help: "Collection time at which the last node restart, or else the node, was first seen, since unix epoch in seconds",
+	}, func() float64 {
+		return t.readState(func(s *targetState) float64 { return s.NodeStartTime })
+	}))
+	registerFrom(registerer, "/system/peers", newCounterFunc(prometheus.CounterOpts{
+		Name: "radix_peers_connected_total",
+		Help: "Count of peers seen connecting between collections",
+	}, func() float64 {
+		return t.readState(func(s *targetState) float64 { return s.PeersConnected })
+	}))
+	registerFrom(registerer, "/system/peers", newCounterFunc(prometheus.CounterOpts{
+		Name: "radix_peers_disconnected_total",
+		Help: "Count of peers seen disconnecting between collections",
+	}, func() float64 {
+		return t.readState(func(s *targetState) float64 { return s.PeersDisconnected })
+	}))
+	t.registerFor("peers", "/system/peers", newGaugeFunc(prometheus.GaugeOpts{
+		Name: "radix_peers_session_age_seconds_avg",
+		Help: "Average time the current peers have been connected for, as far as collections could tell",
+	}, t.peerSessionAge))
+	registerFrom(registerer, "/system/epochproof", newGaugeFunc(prometheus.GaugeOpts{
+		Name: "radix_ledger_seconds_since_epoch_change",
+		Help: "Seconds since the epoch number last changed",
+	}, t.secondsSinceEpochChange))
+	registerFrom(registerer, "exporter",
+		t.collectionDuration, t.backupActive, t.up, t.nodeReachable, t.collectorSuccess)
+	for _, result := range []string{"success", "failure"} {
+		result := result
+		registerFrom(registerer, "exporter", newCounterFunc(prometheus.CounterOpts{
+			Name:        "radix_exporter_collections_total",
+			Help:        "Count of full collection cycles by result, across runs with -state",
+			ConstLabels: prometheus.Labels{"result": result},
+		}, func() float64 {
+			return t.readState(func(s *targetState) float64 { return s.Collections[result] })
+		}))
+	}
+	registerFrom(registerer, "exporter", newCounterFunc(prometheus.CounterOpts{
+		Name: "radix_exporter_collection_allocated_bytes_total",
+		Help: "Bytes allocated during collection cycles, including by anything else running at the time, across runs with -state",
+	}, func() float64 {
+		return t.readState(func(s *targetState) float64 { return s.CollectionAllocatedBytes })
+	}))
+	registerFrom(registerer, "exporter", newCounterFunc(prometheus.CounterOpts{
+		Name: "radix_exporter_collection_allocations_total",
+		Help: "Count of heap objects allocated during collection cycles, including by anything else running at the time, across runs with -state",
+	}, func() float64 {
+		return t.readState(func(s *targetState) float64 { return s.CollectionAllocations })
+	}))
+	registerer.MustRegister(pluginCollector{t})
+
+	return t
+}
+
+// keepBody remembers the response of endpoint for the rest of the cycle.
+func (t *target) keepBody(endpoint string, body []byte) {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	t.bodies[endpoint] = body
+}
+
+// body returns the response of endpoint if it was fetched in this cycle.
+func (t *target) body(endpoint string) ([]byte, bool) {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	body, found := t.bodies[endpoint]
+	return body, found
+}
+
+// bodyOrGet returns the response of endpoint, only fetching it if no
+// collector did yet in this cycle.
+func (t *target) bodyOrGet(endpoint string) ([]byte, error) {
+	body, found := t.body(endpoint)
+	if found {
+		return body, nil
+	}
+	return t.getData(endpoint)
+}
+
+func (t *target) resetCycle() {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	t.bodies = map[string][]byte{}
+	t.traces = nil
+
+	// Collectors combining endpoints must not see a previous cycle's
+	// results if an endpoint fails
+	t.peers = nil
+	t.validatorStakes = nil
+	t.validatorAddress = ""
+}
+
+// newTargetWithTransport creates a target sending its requests through rt,
+// e.g. to test a collector against recorded node API responses.
+func newTargetWithTransport(name, baseUrl string, interval time.Duration, registerer prometheus.Registerer, rt http.RoundTripper) *target {
+	t := newTarget(name, baseUrl, interval, registerer)
+	t.useTransport(rt)
+	return t
+}
+
+// useTransport makes t send its requests through rt, e.g. a tunnel, or
+// recorded responses in tests.
+func (t *target) useTransport(rt http.RoundTripper) {
+	t.client.Transport = rt
+}
+
+// useUrl switches the node API of t, between its primary and fallbacks.
+func (t *target) useUrl(url string) {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	t.activeUrl = url
+}
+
+func (t *target) currentUrl() string {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	return t.activeUrl
+}
+
+// warn logs a problem that did not fail the collection, and keeps it for
+// the -summary-json output.
+func (t *target) warn(format string, v ...interface{}) {
+	warning := fmt.Sprintf(format, v...)
+	log.Print(t.logPrefix(), warning)
+
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	t.warnings = append(t.warnings, warning)
+}
+
+func (t *target) resetWarnings() {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	t.warnings = nil
+}
+
+// logPrefix tells apart log lines of different networks.
+func (t *target) logPrefix() string {
+	if t.name == "" {
+		return ""
+	}
+	return "[" + t.name + "] "
+}
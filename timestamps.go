@@ -0,0 +1,88 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/tidwall/gjson"
+)
+
+// Export samples with the time the node measured them at, if known
+var sourceTimestamps bool
+
+// timestampSources tells where metrics measured at a known time get it
+// from: a response of the last collection and the path of the time in it,
+// in milliseconds since unix epoch or RFC 3339. Metrics computed from more
+// than that response, e.g. from the stake history, are not listed.
+var timestampSources = []struct {
+	names    []string
+	endpoint string
+	path     string
+}{
+	{[]string{
+		"radix_validator_next_validators_count",
+		"radix_validator_next_validators_stake_min",
+		"radix_validator_next_validators_stake_max",
+	}, "/system/epochproof", "header.timestamp"},
+	{[]string{"radix_gateway_ledger_state_version"}, "/status/network-status", "ledger_state.proposer_round_timestamp"},
+}
+
+// timestampedGatherer gathers the registry, giving the metrics of
+// timestampSources the time of their measurement rather than leaving the
+// consumer to assume the collection time. node_exporter's textfile collector
+// refuses explicit timestamps, so this is meant for other consumers of the
+// textfile.
+type timestampedGatherer struct {
+	targets []*target
+}
+
+func (g timestampedGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, gatherErr := registry.Gather()
+
+	for _, t := range g.targets {
+		for _, source := range timestampSources {
+			body, found := t.body(source.endpoint)
+			if !found {
+				continue
+			}
+			measured := sourceTime(gjson.GetBytes(body, source.path))
+			if measured.IsZero() {
+				continue
+			}
+			ms := measured.UnixNano() / int64(time.Millisecond)
+
+			for _, family := range families {
+				if !containsName(source.names, family.GetName()) {
+					continue
+				}
+				for _, m := range family.GetMetric() {
+					if hasAnyLabels(m, []prometheus.Labels{t.labels}) {
+						m.TimestampMs = &ms
+					}
+				}
+			}
+		}
+	}
+	return families, gatherErr
+}
+
+func sourceTime(value gjson.Result) time.Time {
+	switch value.Type {
+	case gjson.Number:
+		return time.Unix(0, value.Int()*int64(time.Millisecond))
+	case gjson.String:
+		parsed, _ := time.Parse(time.RFC3339, value.String())
+		return parsed
+	}
+	return time.Time{}
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
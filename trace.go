@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// endpointTrace holds when each step of fetching and processing one
+// endpoint happened, to tell whether slowness comes from the node, the
+// network or the exporter.
+type endpointTrace struct {
+	endpoint     string
+	node         bool
+	status       int
+	err          error
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	readDone     time.Time
+	parseDone    time.Time
+	registerDone time.Time
+}
+
+func (t *target) startTrace(baseUrl, endpoint string) *endpointTrace {
+	trace := &endpointTrace{endpoint: endpoint, start: time.Now()}
+
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	trace.node = baseUrl == t.activeUrl
+	t.traces = append(t.traces, trace)
+	return trace
+}
+
+// reachable tells whether the node API answered a request of the last
+// collection, other than with the gateway error of a proxy in front of it,
+// or was not requested at all.
+func (t *target) reachable() bool {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	requested := false
+	for _, trace := range t.traces {
+		if !trace.node {
+			continue
+		}
+		requested = true
+		switch trace.status {
+		case 0, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		default:
+			return true
+		}
+	}
+	return !requested
+}
+
+// parsed marks the response of endpoint as parsed. What happens after it,
+// up to the end of the collector, counts as registering metrics.
+func (t *target) parsed(endpoint string) {
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	for i := len(t.traces) - 1; i >= 0; i-- {
+		if t.traces[i].endpoint == endpoint {
+			t.traces[i].parseDone = time.Now()
+			return
+		}
+	}
+}
+
+// finishTraces ends the traces of the collector that just ran.
+func (t *target) finishTraces() {
+	now := time.Now()
+
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	for _, trace := range t.traces {
+		if trace.registerDone.IsZero() {
+			if trace.parseDone.IsZero() {
+				trace.parseDone = now
+			}
+			trace.registerDone = now
+		}
+	}
+}
+
+func (t *target) logTraces() {
+	if logLevel != "debug" {
+		return
+	}
+
+	t.cycleMu.Lock()
+	defer t.cycleMu.Unlock()
+
+	for _, trace := range t.traces {
+		debugf("%sendpoint=%s dns=%s connect=%s tls=%s ttfb=%s read=%s parse=%s register=%s total=%s",
+			t.logPrefix(),
+			trace.endpoint,
+			between(trace.dnsStart, trace.dnsDone),
+			between(trace.connectStart, trace.connectDone),
+			between(trace.connectDone, trace.tlsDone),
+			between(trace.wroteRequest, trace.firstByte),
+			between(trace.firstByte, trace.readDone),
+			between(trace.readDone, trace.parseDone),
+			between(trace.parseDone, trace.registerDone),
+			between(trace.start, trace.registerDone),
+		)
+	}
+}
+
+func (trace *endpointTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			trace.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			trace.dnsDone = time.Now()
+		},
+		ConnectStart: func(_, _ string) {
+			if trace.connectStart.IsZero() {
+				trace.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				trace.connectDone = time.Now()
+			}
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			trace.tlsDone = time.Now()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			trace.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			trace.firstByte = time.Now()
+		},
+	}
+}
+
+// between is the time from a to b, or zero if either step did not happen,
+// e.g. no DNS lookup or connect for a reused connection.
+func between(a, b time.Time) time.Duration {
+	if a.IsZero() || b.IsZero() {
+		return 0
+	}
+	return b.Sub(a).Round(time.Microsecond)
+}